@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"context"
+	"strings"
+	"path/filepath"
+
+	"github.com/qasico/fire/helper"
+)
+
+// Actions of watch.actions in fire.json, other values are commands.
+const (
+	actionRebuild = "rebuild"
+	actionRestart = "restart"
+	actionNotify  = "notify"
+	actionNone    = "none"
+)
+
+// watchAction is an entry of watch.actions, pattern being an extension
+// such as ".sql" or a .gitignore like glob such as "conf/*.conf".
+type watchAction struct {
+	pattern string
+	match   *helper.Ignore
+	action  string
+}
+
+var watchActions []watchAction
+
+// loadWatchActions compiles watch.actions, the longest patterns first so
+// that the most specific one wins.
+func loadWatchActions() {
+	watchActions = nil
+	for pattern, action := range conf.Watch.Actions {
+		a := watchAction{pattern: pattern, action: strings.TrimSpace(action)}
+		if !isExtPattern(pattern) {
+			a.match = helper.NewIgnore([]string{pattern})
+		}
+		watchActions = append(watchActions, a)
+	}
+	sort.Slice(watchActions, func(i, j int) bool {
+		if len(watchActions[i].pattern) != len(watchActions[j].pattern) {
+			return len(watchActions[i].pattern) > len(watchActions[j].pattern)
+		}
+		return watchActions[i].pattern < watchActions[j].pattern
+	})
+}
+
+func isExtPattern(pattern string) bool {
+	return strings.HasPrefix(pattern, ".") && !strings.ContainsAny(pattern, "/*?[")
+}
+
+// findAction returns the watch.actions entry of the path relative to the app.
+func findAction(rel string) (action string, ok bool) {
+	for _, a := range watchActions {
+		if a.match == nil && strings.HasSuffix(rel, a.pattern) {
+			return a.action, true
+		}
+		if a.match != nil && a.match.Match(filepath.ToSlash(rel), false) {
+			return a.action, true
+		}
+	}
+	return "", false
+}
+
+// actionFor returns what a change of the path relative to the app does. Go
+// files and directories rebuild, other files rebuild too unless live reload
+// is on, in which case reloading the browser tabs is enough.
+func actionFor(rel string) string {
+	if action, ok := findAction(rel); ok {
+		return action
+	}
+	if ext := filepath.Ext(rel); ext == ".go" || ext == "" || liveReload == nil {
+		return actionRebuild
+	}
+	return actionNotify
+}
+
+// runActions runs the commands of the changed files, then rebuilds,
+// restarts or reloads the browser tabs, the heaviest action needed winning.
+func runActions(changed []string, files []string) {
+	var commands []string
+	seen := make(map[string]bool)
+	need := actionNone
+	for _, name := range changed {
+		action := actionFor(name)
+		switch action {
+		case actionRebuild:
+			need = actionRebuild
+		case actionRestart:
+			if need != actionRebuild {
+				need = actionRestart
+			}
+		case actionNotify:
+			if need == actionNone {
+				need = actionNotify
+			}
+		case actionNone, "":
+		default:
+			if !seen[action] {
+				seen[action] = true
+				commands = append(commands, action)
+			}
+		}
+	}
+
+	for _, command := range commands {
+		helper.ColorLog("[INFO] Running %s\n", command)
+		c := shellCommand(context.Background(), command)
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		if err := c.Run(); err != nil {
+			helper.ColorLog("[ERRO] %s[ %s ]\n", command, err)
+		}
+	}
+
+	switch need {
+	case actionRebuild:
+		Autobuild(files, changed)
+	case actionRestart:
+		restartApp(changed)
+	case actionNotify:
+		if liveReload != nil {
+			helper.ColorLog("[INFO] Reloading browser tabs\n")
+			liveReload.reload()
+		}
+	}
+}
+
+// restartApp restarts the app without building it.
+func restartApp(changed []string) {
+	state.Lock()
+	defer state.Unlock()
+	helper.ColorLog("[INFO] Restarting without building...\n")
+	Restart(context.Background(), appname, changed)
+}
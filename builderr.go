@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"bufio"
+	"regexp"
+	"strconv"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"html/template"
+)
+
+// buildError is a compiler error of a failed build.
+type buildError struct {
+	File    string        `json:"file"`
+	Line    int           `json:"line"`
+	Column  int           `json:"column,omitempty"`
+	Message string        `json:"message"`
+	Snippet []snippetLine `json:"snippet,omitempty"`
+}
+
+type snippetLine struct {
+	Line    int    `json:"line"`
+	Code    string `json:"code"`
+	Current bool   `json:"current,omitempty"`
+}
+
+// buildFailure is served by the proxy until the next successful build, or
+// until the crashed app is started again.
+type buildFailure struct {
+	// Title is "Build failed" or tells the app crashed, see serveCrash.
+	Title  string       `json:"-"`
+	Errors []buildError `json:"errors"`
+	// Output is the raw output of the failed commands.
+	Output string       `json:"output"`
+	// Script is the live reload tag of the page, if enabled.
+	Script template.HTML `json:"-"`
+	// crash is set for the failures of serveCrash.
+	crash  bool
+}
+
+// compilerError matches "file.go:line:col: message" and "file.go:line: message".
+var compilerError = regexp.MustCompile(`^(\S+\.go):(\d+)(?::(\d+))?: (.+)$`)
+
+// parseBuildErrors extracts the compiler errors of output, with a few lines
+// of code around each of them. Indented lines following an error, such as
+// the "have" and "want" lines of the type checker, continue its message.
+func parseBuildErrors(output string) *buildFailure {
+	f := &buildFailure{Title: "Build failed", Output: output}
+	if liveReload != nil {
+		f.Script = liveReloadTag
+	}
+	continued := false
+	for _, line := range strings.Split(strings.Replace(output, "\r\n", "\n", -1), "\n") {
+		m := compilerError.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continued = continued && strings.TrimSpace(line) != "" && (line[0] == '\t' || line[0] == ' ')
+			if continued {
+				e := &f.Errors[len(f.Errors) - 1]
+				e.Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+		e := buildError{File: m[1], Message: m[4]}
+		e.Line, _ = strconv.Atoi(m[2])
+		e.Column, _ = strconv.Atoi(m[3])
+		e.Snippet = readSnippet(e.File, e.Line, 2)
+		f.Errors = append(f.Errors, e)
+		continued = true
+	}
+	return f
+}
+
+// readSnippet returns the lines of file around line.
+func readSnippet(file string, line, around int) (snippet []snippetLine) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for n := 1; scanner.Scan() && n <= line + around; n++ {
+		if n >= line - around {
+			snippet = append(snippet, snippetLine{Line: n, Code: scanner.Text(), Current: n == line})
+		}
+	}
+	return
+}
+
+var buildErrorPage = template.Must(template.New("build").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #333; }
+h1 { color: #c0392b; }
+.error { margin-bottom: 2em; }
+.file { font-weight: bold; }
+.message { white-space: pre-wrap; }
+pre { background: #f6f6f6; padding: 1em; overflow: auto; }
+.current { background: #fadbd8; display: block; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Errors}}<div class="error">
+<p><span class="file">{{.File}}:{{.Line}}{{if .Column}}:{{.Column}}{{end}}</span> <span class="message">{{.Message}}</span></p>
+{{if .Snippet}}<pre>{{range .Snippet}}<span{{if .Current}} class="current"{{end}}>{{printf "%4d" .Line}}  {{.Code}}</span>
+{{end}}</pre>{{end}}
+</div>
+{{else}}<pre>{{.Output}}</pre>
+{{end}}<p>This page is served by fire run until the next successful build.</p>
+{{.Script}}
+</body>
+</html>
+`))
+
+// ServeHTTP writes the failure as JSON when the request accepts it, as an
+// HTML page otherwise.
+func (f *buildFailure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+			*buildFailure
+		}{strings.ToLower(f.Title), f})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	buildErrorPage.Execute(w, f)
+}
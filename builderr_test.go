@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestParseBuildErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		errors []buildError
+	}{
+		{"compiler", `# app/controllers
+controllers/user.go:12:2: undefined: models.GetUser
+controllers/user.go:30:15: cannot use id (variable of type string) as int value in argument to models.DeleteUser
+`, []buildError{
+			{File: "controllers/user.go", Line: 12, Column: 2, Message: "undefined: models.GetUser"},
+			{File: "controllers/user.go", Line: 30, Column: 15, Message: "cannot use id (variable of type string) as int value in argument to models.DeleteUser"},
+		}},
+		{"relative and multi-line", `# app/models
+./user.go:20:9: too many return values
+	have (number, nil)
+	want (error)
+./user.go:25:1: missing return
+too many errors
+`, []buildError{
+			{File: "./user.go", Line: 20, Column: 9, Message: "too many return values\nhave (number, nil)\nwant (error)"},
+			{File: "./user.go", Line: 25, Column: 1, Message: "missing return"},
+		}},
+		{"no column", `# app
+main.go:7: syntax error: unexpected newline, expected comma or }
+`, []buildError{
+			{File: "main.go", Line: 7, Message: "syntax error: unexpected newline, expected comma or }"},
+		}},
+		{"vet", `# app/models
+# [app/models]
+models/user.go:41:3: fmt.Sprintf format %d has arg name of wrong type string
+models/user.go:52:2: unreachable code
+`, []buildError{
+			{File: "models/user.go", Line: 41, Column: 3, Message: "fmt.Sprintf format %d has arg name of wrong type string"},
+			{File: "models/user.go", Line: 52, Column: 2, Message: "unreachable code"},
+		}},
+		{"tests", `=== RUN   TestAdd
+    lib_test.go:7: bad add
+        got 4
+--- FAIL: TestAdd (0.00s)
+FAIL
+`, []buildError{
+			{File: "lib_test.go", Line: 7, Message: "bad add\ngot 4"},
+		}},
+		{"crlf", "main.go:3:1: expected 'package', found pakage\r\n", []buildError{
+			{File: "main.go", Line: 3, Column: 1, Message: "expected 'package', found pakage"},
+		}},
+		{"no errors", "go: cannot find main module, but found .git/config in /src\n\tto create a module there, run:\n\tgo mod init\n", nil},
+	}
+	for _, c := range cases {
+		f := parseBuildErrors(c.output)
+		if f.Output != c.output {
+			t.Errorf("%s: the output is not kept", c.name)
+		}
+		if !reflect.DeepEqual(f.Errors, c.errors) {
+			t.Errorf("%s: got\n%+v\nwant\n%+v", c.name, f.Errors, c.errors)
+		}
+	}
+}
+
+func TestParseBuildErrorsSnippet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fire-builderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "main.go")
+	src := "package main\n\nfunc main() {\n\tx := 1\n}\n"
+	if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := parseBuildErrors(file + ":4:2: declared and not used: x\n")
+	if len(f.Errors) != 1 {
+		t.Fatalf("got %d errors, want 1", len(f.Errors))
+	}
+	want := []snippetLine{
+		{Line: 2, Code: ""},
+		{Line: 3, Code: "func main() {"},
+		{Line: 4, Code: "\tx := 1", Current: true},
+		{Line: 5, Code: "}"},
+	}
+	if got := f.Errors[0].Snippet; !reflect.DeepEqual(got, want) {
+		t.Errorf("snippet = %+v, want %+v", got, want)
+	}
+}
@@ -15,15 +15,27 @@
 package main
 
 import (
+	"io"
+	"os"
+	"fmt"
+	"bytes"
+	"regexp"
+	"reflect"
+	"strings"
+	"io/ioutil"
 	"encoding/json"
 
 	"github.com/qasico/fire/helper"
 )
 
-const CONF_VER = 0
+// CONF_VER is the format version of fire.json, see confMigrations.
+const CONF_VER = 1
+
+// configFile is the project configuration, read from the app root.
+const configFile = "fire.json"
 
 var defaultConf = `{
-	"version": 0,
+	"version": 1,
 	"gopm": {
 		"enable": false,
 		"install": false
@@ -36,53 +48,194 @@ var defaultConf = `{
 		"models": "",
 		"others": []
 	},
+	"watch": {
+		"exclude": [],
+		"actions": {}
+	},
 	"cmd_args": [],
 	"envs": [],
+	"hooks": {
+		"pre_build": [],
+		"post_build": [],
+		"pre_start": []
+	},
+	"restart": {
+		"signal": "SIGTERM",
+		"grace_period": 5,
+		"ready_timeout": 30,
+		"policy": "no",
+		"max_crashes": 5,
+		"crash_window": 60
+	},
+	"test": {
+		"block": false,
+		"args": []
+	},
+	"debug": {
+		"host": "127.0.0.1",
+		"port": 2345,
+		"args": []
+	},
+	"bale": {
+		"import": "",
+		"dirs": [],
+		"ignore_ext": []
+	},
 	"database": {
-		"driver": "mysql"
-	}
+		"driver": "mysql",
+		"conn": "",
+		"include": [],
+		"exclude": ["migrations"],
+		"sensitive": []
+	},
+	"profiles": {}
 }
 `
+// defaultWatchExclude is always excluded from watching, watch.exclude adding
+// to it. docs/ and swagger/ are written by fire itself, the others are
+// dependencies, temporary files and editor swap files.
+var defaultWatchExclude = []string{"vendor/", "node_modules/", "tmp/", "docs/", "swagger/", "*.swp", "*.swx", "*~", ".#*", "4913"}
+
 var conf struct {
-	Version   int
+	Version   int      `json:"version"`
 	// gopm support
 	Gopm      struct {
-			  Enable  bool
-			  Install bool
-		  }
+			  Enable  bool `json:"enable"`
+			  Install bool `json:"install"`
+		  } `json:"gopm"`
 	// Indicates whether execute "go install" before "go build".
 	GoInstall bool     `json:"go_install"`
 	WatchExt  []string `json:"watch_ext"`
-	DirStruct struct {
-			  WatchAll    bool `json:"watch_all"`
-			  Controllers string
-			  Models      string
-			  Others      []string // Other directories.
-		  } `json:"dir_structure"`
+	DirStruct confDirStruct `json:"dir_structure"`
+	Watch     confWatch `json:"watch"`
 	CmdArgs   []string `json:"cmd_args"`
-	Envs      []string
+	Envs      []string `json:"envs"`
+	Hooks     struct {
+			  PreBuild  []confHook `json:"pre_build"`
+			  PostBuild []confHook `json:"post_build"`
+			  PreStart  []confHook `json:"pre_start"`
+		  } `json:"hooks"`
+	Restart   struct {
+			  // Signal asking the app to stop, one of SIGTERM, SIGINT,
+			  // SIGQUIT, SIGHUP or SIGKILL.
+			  Signal       string `json:"signal"`
+			  // Seconds to wait for the app to stop before killing it.
+			  GracePeriod  int    `json:"grace_period"`
+			  // Seconds to wait for the app to accept connections on API_PORT.
+			  ReadyTimeout int    `json:"ready_timeout"`
+			  // Policy restarts the app when it exits: no, on-failure or always.
+			  Policy       string `json:"policy"`
+			  // Automatic restarts stop after MaxCrashes crashes within
+			  // CrashWindow seconds, until the next change.
+			  MaxCrashes   int    `json:"max_crashes"`
+			  CrashWindow  int    `json:"crash_window"`
+		  } `json:"restart"`
+	Test      struct {
+			  // Block keeps the previous app running when the tests fail.
+			  Block bool     `json:"block"`
+			  // Args are passed to go test, e.g. ["-race", "-count=1"].
+			  Args  []string `json:"args"`
+		  } `json:"test"`
+	Debug     struct {
+			  // Host and Port of the dlv server of fire run -debug.
+			  Host string   `json:"host"`
+			  Port int      `json:"port"`
+			  // Args are passed to dlv exec, e.g. ["--log"].
+			  Args []string `json:"args"`
+		  } `json:"debug"`
 	Bale      struct {
-			  Import string
-			  Dirs   []string
+			  Import string   `json:"import"`
+			  Dirs   []string `json:"dirs"`
 			  IngExt []string `json:"ignore_ext"`
-		  }
-	Database  struct {
-			  Driver string
-			  Conn   string
-		  }
+		  } `json:"bale"`
+	Database  confDatabase `json:"database"`
+	// Profiles override parts of the configuration, the active one is
+	// chosen with -profile or FIRE_PROFILE.
+	Profiles  map[string]confProfile `json:"profiles"`
+}
+
+type confDirStruct struct {
+	WatchAll    bool     `json:"watch_all"`
+	Controllers string   `json:"controllers"`
+	Models      string   `json:"models"`
+	Others      []string `json:"others"` // Other directories.
+}
+
+// confHook is a command fire run runs around builds, see runHooks.
+type confHook struct {
+	Cmd     string `json:"cmd"`
+	// Timeout in seconds, 60 when not set.
+	Timeout int    `json:"timeout,omitempty"`
+	// OnError is "stop", the default, or "continue".
+	OnError string `json:"on_error,omitempty"`
+}
+
+type confWatch struct {
+	// Paths not watched, with the syntax of .gitignore, added to
+	// defaultWatchExclude. The .gitignore and .fireignore files of the app
+	// are applied after them.
+	Exclude []string `json:"exclude"`
+	// Actions maps extensions such as ".sql" or globs such as "conf/*.conf"
+	// to rebuild, restart, notify, none or a command to run.
+	Actions map[string]string `json:"actions"`
+}
+
+type confDatabase struct {
+	Driver    string   `json:"driver"`
+	Conn      string   `json:"conn"`
+	// Table name patterns, see generator.TableFilter.
+	Include   []string `json:"include"`
+	Exclude   []string `json:"exclude"`
+	// Column name patterns hidden from json output, the generator
+	// defaults are used when not set.
+	Sensitive []string `json:"sensitive"`
+}
+
+// confProfile lists the keys a profile may override, the keys it sets are
+// merged over the top level ones.
+type confProfile struct {
+	WatchExt  []string      `json:"watch_ext,omitempty"`
+	DirStruct *confDirStruct `json:"dir_structure,omitempty"`
+	Watch     *confWatch     `json:"watch,omitempty"`
+	CmdArgs   []string      `json:"cmd_args,omitempty"`
+	Envs      []string      `json:"envs,omitempty"`
+	Database  *confDatabase  `json:"database,omitempty"`
+}
+
+// profile is the name of the active profile of fire.json.
+var profile docValue
+
+// activeProfile returns the profile given by -profile or FIRE_PROFILE.
+func activeProfile() string {
+	if profile != "" {
+		return profile.String()
+	}
+	return os.Getenv("FIRE_PROFILE")
+}
+
+// confMigrations[i] upgrades a fire.json of version i to version i+1.
+var confMigrations = []func(map[string]interface{}){
+	// files written before versioning only lack the version key, watch_ext
+	// entries still being matched as suffixes of the file names
+	func(m map[string]interface{}) {},
 }
 
-// loadConfig loads customized configuration.
+// loadConfig loads the default configuration and merges the fire.json of
+// the current directory over it when present, followed by the active profile.
 func loadConfig() error {
 	err := json.Unmarshal([]byte(defaultConf), &conf)
 	if err != nil {
 		return err
 	}
 
-	// Check format version.
-	if conf.Version != CONF_VER {
-		helper.ColorLog("[WARN] Your conf.json is out-of-date, please update!\n")
-		helper.ColorLog("[HINT] Compare bee.json under bee source code path and yours\n")
+	data, err := ioutil.ReadFile(configFile)
+	if err == nil {
+		err = parseConfig(data, activeProfile())
+	} else if os.IsNotExist(err) {
+		err = nil
+		if name := activeProfile(); name != "" {
+			err = fmt.Errorf("profile %s is not defined, %s does not exist", name, configFile)
+		}
 	}
 
 	// Set variables.
@@ -95,5 +248,300 @@ func loadConfig() error {
 
 	// Append watch exts.
 	watchExts = append(watchExts, conf.WatchExt...)
+	// a "!pattern" of watch.exclude watches a default exclude again
+	conf.Watch.Exclude = append(append([]string{}, defaultWatchExclude...), conf.Watch.Exclude...)
+	return err
+}
+
+// migrateConfig validates data and upgrades it to CONF_VER, returning the
+// configuration as written, variables and profiles left as they are, and
+// the version it had.
+func migrateConfig(data []byte) (m map[string]interface{}, version int, err error) {
+	if err = validateConfig(data); err != nil {
+		return nil, 0, err
+	}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, 0, err
+	}
+	// files written before versioning, or by hand, lack the key
+	if v, ok := m["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > CONF_VER {
+		return nil, version, fmt.Errorf("version %d is newer than the supported version %d, please update fire", version, CONF_VER)
+	}
+	if version < 0 {
+		return nil, version, fmt.Errorf("invalid version %d", version)
+	}
+	if version < CONF_VER {
+		for _, migrate := range confMigrations[version:] {
+			migrate(m)
+		}
+		m["version"] = CONF_VER
+	}
+	return m, version, nil
+}
+
+// parseConfig validates data, upgrades it to CONF_VER, interpolates the
+// variables of the base configuration and of the profile name and merges
+// them into conf, applying the profile if name is not empty.
+func parseConfig(data []byte, name string) error {
+	m, version, err := migrateConfig(data)
+	if err != nil {
+		return err
+	}
+	if version < CONF_VER {
+		// stderr keeps the output of fire config show usable as is
+		fmt.Fprint(os.Stderr, helper.ColorLogS("[WARN] Your %s is version %d, it has been migrated to version %d\n", configFile, version, CONF_VER))
+		fmt.Fprint(os.Stderr, helper.ColorLogS("[HINT] Save the output of 'fire config show -raw' as %s to update it\n", configFile))
+	}
+
+	// only the base configuration and the active profile are interpolated,
+	// the variables of the other profiles need not be set
+	profiles, _ := m["profiles"].(map[string]interface{})
+	var p interface{}
+	if name != "" {
+		var ok bool
+		if p, ok = profiles[name]; !ok {
+			return fmt.Errorf("profile %s is not defined", name)
+		}
+	}
+	delete(m, "profiles")
+	dotenv := envLookup()
+	interpolate(m, dotenv)
+	if p != nil {
+		p = interpolate(p, dotenv)
+	}
+	if profiles != nil {
+		m["profiles"] = profiles
+	}
+
+	if data, err = json.Marshal(m); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	// unmarshaling over conf only replaces the keys set by the profile
+	if data, err = json.Marshal(p); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &conf)
+}
+
+var varPattern = regexp.MustCompile(`\$\{(env:)?([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate replaces ${VAR} in the strings of v by the environment variable
+// VAR and ${env:VAR} by the variable VAR of the .env file of the project,
+// the environment taking precedence.
+func interpolate(v interface{}, dotenv map[string]string) interface{} {
+	switch t := v.(type) {
+	case string:
+		return varPattern.ReplaceAllStringFunc(t, func(s string) string {
+			match := varPattern.FindStringSubmatch(s)
+			if value, ok := os.LookupEnv(match[2]); ok {
+				return value
+			}
+			if value, ok := dotenv[match[2]]; ok && match[1] != "" {
+				return value
+			}
+			fmt.Fprint(os.Stderr, helper.ColorLogS("[WARN] %s: %s is not set\n", configFile, s))
+			return ""
+		})
+	case []interface{}:
+		for i := range t {
+			t[i] = interpolate(t[i], dotenv)
+		}
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = interpolate(t[k], dotenv)
+		}
+	}
+	return v
+}
+
+// envLookup returns the variables of the .env file of the project.
+func envLookup() map[string]string {
+	vars := make(map[string]string)
+	env, err := helper.LoadEnvFiles(".env")
+	if err != nil {
+		fmt.Fprint(os.Stderr, helper.ColorLogS("[WARN] Fail to load env file[ %s ]\n", err))
+	}
+	for _, kv := range env {
+		i := strings.Index(kv, "=")
+		vars[kv[:i]] = kv[i+1:]
+	}
+	return vars
+}
+
+// validateConfig checks data against the conf struct, reporting unknown keys
+// and mistyped values with their line.
+func validateConfig(data []byte) error {
+	v := &confValidator{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	v.dec.UseNumber()
+	if err := v.value(reflect.TypeOf(conf), ""); err != nil {
+		return err
+	}
+	if _, err := v.dec.Token(); err != io.EOF {
+		return v.errorf("unexpected data after the configuration")
+	}
+	return nil
+}
+
+type confValidator struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// errorf prefixes the error with the line of the last read token.
+func (v *confValidator) errorf(format string, args ...interface{}) error {
+	offset := v.dec.InputOffset()
+	if offset > int64(len(v.data)) {
+		offset = int64(len(v.data))
+	}
+	line := bytes.Count(v.data[:offset], []byte("\n")) + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (v *confValidator) token() (json.Token, error) {
+	tok, err := v.dec.Token()
+	if err == io.EOF {
+		return nil, v.errorf("unexpected end of file")
+	}
+	if serr, ok := err.(*json.SyntaxError); ok {
+		line := bytes.Count(v.data[:serr.Offset], []byte("\n")) + 1
+		return nil, fmt.Errorf("line %d: %s", line, serr)
+	}
+	if err != nil {
+		return nil, v.errorf("%s", err)
+	}
+	return tok, nil
+}
+
+func (v *confValidator) value(t reflect.Type, key string) error {
+	tok, err := v.token()
+	if err != nil {
+		return err
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	ok := false
+	switch t.Kind() {
+	case reflect.Struct:
+		if ok = tok == json.Delim('{'); ok {
+			return v.object(t, key)
+		}
+	case reflect.Map:
+		if ok = tok == json.Delim('{'); ok {
+			return v.mapping(t, key)
+		}
+	case reflect.Slice:
+		if ok = tok == json.Delim('['); ok {
+			for i := 0; v.dec.More(); i++ {
+				if err := v.value(t.Elem(), fmt.Sprintf("%s[%d]", key, i)); err != nil {
+					return err
+				}
+			}
+			_, err = v.token()
+			return err
+		}
+	case reflect.String:
+		_, ok = tok.(string)
+	case reflect.Bool:
+		_, ok = tok.(bool)
+	case reflect.Int:
+		if n, isNum := tok.(json.Number); isNum {
+			_, err := n.Int64()
+			ok = err == nil
+		}
+	}
+	if !ok {
+		return v.errorf("%s must be %s, got %s", key, typeName(t), tokenName(tok))
+	}
 	return nil
 }
+
+func (v *confValidator) object(t reflect.Type, key string) error {
+	for v.dec.More() {
+		tok, err := v.token()
+		if err != nil {
+			return err
+		}
+		name := tok.(string)
+		if key != "" {
+			name = key + "." + name
+		}
+		field, ok := confField(t, tok.(string))
+		if !ok {
+			return v.errorf("unknown key %s", name)
+		}
+		if err := v.value(field.Type, name); err != nil {
+			return err
+		}
+	}
+	_, err := v.token()
+	return err
+}
+
+// mapping checks an object with arbitrary keys against the element type of t.
+func (v *confValidator) mapping(t reflect.Type, key string) error {
+	for v.dec.More() {
+		tok, err := v.token()
+		if err != nil {
+			return err
+		}
+		if err := v.value(t.Elem(), key + "." + tok.(string)); err != nil {
+			return err
+		}
+	}
+	_, err := v.token()
+	return err
+}
+
+// confField returns the field of t decoded from the json key name.
+func confField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "" {
+			tag = f.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Slice:
+		return "a list of " + strings.TrimPrefix(strings.TrimPrefix(typeName(t.Elem()), "a "), "an ") + "s"
+	case reflect.Int:
+		return "an integer"
+	}
+	return "a " + t.Kind().String()
+}
+
+func tokenName(tok json.Token) string {
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			return "an object"
+		}
+		return "a list"
+	case json.Number:
+		return "the number " + t.String()
+	case string:
+		return fmt.Sprintf("the string %q", t)
+	case bool:
+		return fmt.Sprintf("%t", t)
+	}
+	return "null"
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"io/ioutil"
+	"encoding/json"
+
+	"github.com/qasico/fire/helper"
+)
+
+// resetConf loads the default configuration into conf.
+func resetConf(t *testing.T) {
+	conf.Profiles = nil
+	if err := json.Unmarshal([]byte(defaultConf), &conf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	if err := validateConfig([]byte(defaultConf)); err != nil {
+		t.Errorf("default configuration: %s", err)
+	}
+	cases := []struct {
+		data string
+		err  string
+	}{
+		{"{\n\t\"version\": 1,\n\t\"watch_exts\": []\n}", "line 3: unknown key watch_exts"},
+		{"{\n\t\"restart\": {\n\t\t\"signal\": \"SIGINT\",\n\t\t\"grace\": 3\n\t}\n}", "line 4: unknown key restart.grace"},
+		{"{\n\t\"go_install\": \"yes\"\n}", `line 2: go_install must be a bool, got the string "yes"`},
+		{"{\n\t\"watch_ext\": [\".tpl\",\n\t\t3]\n}", "line 3: watch_ext[1] must be a string, got the number 3"},
+		{"{\n\t\"restart\": {\"grace_period\": 1.5}\n}", "line 2: restart.grace_period must be an integer, got the number 1.5"},
+		{"{\n\t\"cmd_args\": {}\n}", "line 2: cmd_args must be a list of strings, got an object"},
+		{"{\n\t\"profiles\": {\n\t\t\"dev\": {\"watch_ext\": [\".tpl\"], \"port\": 1}\n\t}\n}", "line 3: unknown key profiles.dev.port"},
+		{"{\n\t\"version\": 1,\n\t\"envs\": [\"A=1\"]\n\t\"cmd_args\": []\n}", "line 4: invalid character '\"' after object key:value pair"},
+		{"{}\n{}", "line 2: unexpected data after the configuration"},
+	}
+	for _, c := range cases {
+		err := validateConfig([]byte(c.data))
+		if err == nil || err.Error() != c.err {
+			t.Errorf("%s\ngot error %v, want %s", c.data, err, c.err)
+		}
+	}
+}
+
+func TestParseConfigMigrates(t *testing.T) {
+	cases := []struct {
+		data string
+		exts []string
+	}{
+		{`{"watch_ext": ["tpl", ".html"]}`, []string{"tpl", ".html"}},
+		{`{"version": 0, "watch_ext": ["tpl"]}`, []string{"tpl"}},
+		{`{"version": 1, "watch_ext": [".tpl", "conf.d"]}`, []string{".tpl", "conf.d"}},
+	}
+	for _, c := range cases {
+		resetConf(t)
+		if err := parseConfig([]byte(c.data), ""); err != nil {
+			t.Errorf("%s: %s", c.data, err)
+			continue
+		}
+		if strings.Join(conf.WatchExt, ",") != strings.Join(c.exts, ",") {
+			t.Errorf("%s: watch_ext = %q, want %q", c.data, conf.WatchExt, c.exts)
+		}
+		if conf.Version != CONF_VER {
+			t.Errorf("%s: version = %d, want %d", c.data, conf.Version, CONF_VER)
+		}
+	}
+}
+
+func TestParseConfigVersion(t *testing.T) {
+	resetConf(t)
+	err := parseConfig([]byte(`{"version": 2}`), "")
+	if err == nil || !strings.Contains(err.Error(), "version 2 is newer than the supported version 1") {
+		t.Errorf("got error %v, want a newer version error", err)
+	}
+	resetConf(t)
+	if err := parseConfig([]byte(`{"version": -1}`), ""); err == nil {
+		t.Errorf("negative version accepted")
+	}
+}
+
+func TestWatchExcludeKeepsDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fire-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+	data := `{"version": 1, "watch": {"exclude": ["assets/", "!tmp/"]}}`
+	if err := ioutil.WriteFile(configFile, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	ig := helper.NewIgnore(conf.Watch.Exclude)
+	for dir, excluded := range map[string]bool{"docs": true, "swagger": true, "vendor": true, "assets": true, "tmp": false} {
+		if ig.Match(dir, true) != excluded {
+			t.Errorf("%s/ excluded = %t, want %t", dir, !excluded, excluded)
+		}
+	}
+}
+
+func TestParseConfigInterpolatesActiveProfile(t *testing.T) {
+	os.Setenv("FIRE_TEST_DEV", "dev")
+	defer os.Unsetenv("FIRE_TEST_DEV")
+	data := `{"version": 1, "envs": ["A=${FIRE_TEST_DEV}"], "profiles": {
+		"dev": {"cmd_args": ["${FIRE_TEST_DEV}"]},
+		"prod": {"cmd_args": ["${FIRE_TEST_PROD}"]}
+	}}`
+	resetConf(t)
+	if err := parseConfig([]byte(data), "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(conf.Envs, ",") != "A=dev" || strings.Join(conf.CmdArgs, ",") != "dev" {
+		t.Errorf("envs = %q, cmd_args = %q, want the variables replaced", conf.Envs, conf.CmdArgs)
+	}
+	// FIRE_TEST_PROD is not set, it is not reported as the profile is not used
+	if args := conf.Profiles["prod"].CmdArgs; len(args) != 1 || args[0] != "${FIRE_TEST_PROD}" {
+		t.Errorf("inactive profile interpolated, cmd_args = %q", args)
+	}
+
+	resetConf(t)
+	if err := parseConfig([]byte(data), "stage"); err == nil || err.Error() != "profile stage is not defined" {
+		t.Errorf("got error %v, want an undefined profile error", err)
+	}
+}
+
+func TestMigrateConfigKeepsRaw(t *testing.T) {
+	data := `{"database": {"conn": "${DB_CONN}"}, "watch": {"exclude": ["assets/"]}, "profiles": {"dev": {"envs": ["A=${env:A}"]}}}`
+	m, version, err := migrateConfig([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 || m["version"] != CONF_VER {
+		t.Errorf("version %d migrated to %v, want 0 migrated to %d", version, m["version"], CONF_VER)
+	}
+	out, _ := json.Marshal(m)
+	for _, want := range []string{`"conn":"${DB_CONN}"`, `"exclude":["assets/"]`, `"profiles":{"dev":{"envs":["A=${env:A}"]}}`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("migrated configuration %s lacks %s", out, want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"io/ioutil"
+	"encoding/json"
+
+	"github.com/qasico/fire/helper"
+)
+
+var cmdConfig = &Command{
+	UsageLine: "config [Command]",
+	Short:     "manage the fire.json of the project",
+	Long: `
+fire config init [-force]
+    write the default fire.json in the current directory
+    -force: overwrite an existing fire.json
+
+fire config show [-profile=dev] [-raw]
+    print the effective configuration, the defaults merged with fire.json
+    and the profile given by -profile or $FIRE_PROFILE
+    -raw: print fire.json migrated to the current version instead, with its
+          variables and profiles left as they are, to save it as fire.json
+
+fire config validate
+    check fire.json for unknown keys and values of the wrong type
+`,
+}
+
+var (
+	force   bool
+	showRaw bool
+)
+
+func init() {
+	cmdConfig.Run = configCmd
+	cmdConfig.Flag.BoolVar(&force, "force", false, "overwrite an existing fire.json")
+	cmdConfig.Flag.Var(&profile, "profile", "profile of fire.json to use")
+	cmdConfig.Flag.BoolVar(&showRaw, "raw", false, "print fire.json migrated but not interpolated")
+}
+
+func configCmd(cmd *Command, args []string) int {
+	if len(args) < 1 {
+		helper.ColorLog("[ERRO] command is missing\n")
+		helper.ColorLog("[HINT] Use one of init, show or validate\n")
+		os.Exit(2)
+	}
+	cmd.Flag.Parse(args[1:])
+
+	switch args[0] {
+	case "init":
+		if _, err := os.Stat(configFile); err == nil && !force {
+			helper.ColorLog("[ERRO] %s already exists\n", configFile)
+			helper.ColorLog("[HINT] Use -force to overwrite it\n")
+			os.Exit(2)
+		}
+		if err := ioutil.WriteFile(configFile, []byte(defaultConf), 0644); err != nil {
+			helper.ColorLog("[ERRO] %s\n", err)
+			os.Exit(2)
+		}
+		helper.ColorLog("[INFO] %s => %s\n", configFile, configFile)
+	case "show":
+		if showRaw {
+			if err := printRawConfig(); err != nil {
+				helper.ColorLog("[ERRO] Fail to parse %s[ %s ]\n", configFile, err)
+				os.Exit(2)
+			}
+			return 0
+		}
+		if err := loadConfig(); err != nil {
+			helper.ColorLog("[ERRO] Fail to parse %s[ %s ]\n", configFile, err)
+			os.Exit(2)
+		}
+		data, err := json.MarshalIndent(conf, "", "\t")
+		if err != nil {
+			helper.ColorLog("[ERRO] %s\n", err)
+			os.Exit(2)
+		}
+		fmt.Println(string(data))
+	case "validate":
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			helper.ColorLog("[ERRO] %s\n", err)
+			os.Exit(2)
+		}
+		if err := validateConfig(data); err != nil {
+			helper.ColorLog("[ERRO] %s %s\n", configFile, err)
+			os.Exit(2)
+		}
+		helper.ColorLog("[SUCC] %s is valid\n", configFile)
+	default:
+		helper.ColorLog("[ERRO] Unknown command: %s\n", args[0])
+		os.Exit(2)
+	}
+	return 0
+}
+
+// printRawConfig prints fire.json upgraded to the current version, without
+// the defaults, the interpolation of its variables or the active profile.
+func printRawConfig() error {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	m, _, err := migrateConfig(data)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	return enc.Encode(m)
+}
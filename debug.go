@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"net"
+	"strconv"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/qasico/fire/helper"
+)
+
+// debugGcflags disables the optimizations and inlining getting in the way
+// of the debugger.
+const debugGcflags = "all=-N -l"
+
+// dlvPath is the dlv binary of fire run -debug.
+var dlvPath string
+
+// initDebug finds dlv and applies -debugport.
+func initDebug() {
+	if debugPort != "" {
+		port, err := strconv.Atoi(debugPort.String())
+		if err != nil || port <= 0 {
+			helper.ColorLog("[ERRO] Invalid 'debugport' option: %s\n", debugPort)
+			os.Exit(2)
+		}
+		conf.Debug.Port = port
+	}
+
+	var err error
+	dlvPath, err = exec.LookPath("dlv")
+	if err != nil {
+		// go install puts it in $GOPATH/bin, which may not be in $PATH
+		for _, gopath := range helper.GetGOPATHs() {
+			if p, err := exec.LookPath(filepath.Join(gopath, "bin", "dlv")); err == nil {
+				dlvPath = p
+				break
+			}
+		}
+	}
+	if dlvPath == "" {
+		helper.ColorLog("[ERRO] Fail to find dlv[ %s ]\n", err)
+		helper.ColorLog("[HINT] Install it with 'go install github.com/go-delve/delve/cmd/dlv@latest'\n")
+		os.Exit(2)
+	}
+}
+
+// debugAddr returns the address of the dlv server.
+func debugAddr() string {
+	return net.JoinHostPort(conf.Debug.Host, strconv.Itoa(conf.Debug.Port))
+}
+
+// debugCommand returns the command running the app under a headless dlv
+// server, which lets it run until a client sets breakpoints.
+func debugCommand(appname string, args []string) *exec.Cmd {
+	dlvArgs := []string{"exec", appname, "--headless", "--listen=" + debugAddr(),
+		"--api-version=2", "--accept-multiclient", "--continue"}
+	dlvArgs = append(dlvArgs, conf.Debug.Args...)
+	if len(args) > 0 {
+		dlvArgs = append(append(dlvArgs, "--"), args...)
+	}
+	helper.ColorLog("[INFO] Debugging %s on %s\n", appname, debugAddr())
+	return exec.Command(dlvPath, dlvArgs...)
+}
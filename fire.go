@@ -48,6 +48,8 @@ var commands = []*Command{
 	cmdApiapp,
 	cmdGenerate,
 	cmdPack,
+	cmdConfig,
+	cmdTest,
 }
 
 func main() {
@@ -4,8 +4,10 @@ import (
 	"os"
 	"fmt"
 	"path"
+	"sync"
+	"errors"
 	"regexp"
-	"os/exec"
+	"context"
 	"strings"
 	"database/sql"
 	"path/filepath"
@@ -23,10 +25,10 @@ const (
 )
 
 type DbTransformer interface {
-	GetTableNames(conn *sql.DB) []string
-	GetConstraints(conn *sql.DB, table *Table, blackList map[string]bool)
-	GetColumns(conn *sql.DB, table *Table, blackList map[string]bool)
-	GetGoDataType(sqlType string) string
+	GetTableNames(ctx context.Context, conn *sql.DB) ([]string, error)
+	GetConstraints(ctx context.Context, conn *sql.DB, tables []*Table, blackList map[string]bool) error
+	GetColumns(ctx context.Context, conn *sql.DB, tables []*Table, blackList map[string]bool) error
+	GetGoDataType(sqlType string) (string, error)
 }
 
 type MysqlDB struct {
@@ -46,6 +48,47 @@ type MvcPath struct {
 	RouterPath     string
 }
 
+// Options configures Appcode.
+type Options struct {
+	// Driver is one of mysql or postgres, Conn the connection string used by it.
+	Driver string
+	Conn   string
+	// Level is one of m, mc, r or all, see O_MODEL, O_CONTROLLER and O_ROUTER.
+	Level  string
+	// Tables limits the generated files to the given table names, all
+	// introspected tables are generated when empty.
+	Tables []string
+	// Filter selects the tables to introspect.
+	Filter *TableFilter
+	// AppPath is the application root, PkgPath its import path. PkgPath is
+	// resolved from AppPath and $GOPATH when empty.
+	AppPath string
+	PkgPath string
+	// Workers is the number of batches introspected concurrently and
+	// BatchSize the number of tables fetched by a single bulk query.
+	Workers   int
+	BatchSize int
+	// Sensitive holds the column name patterns, globs or /regexp/ as split by
+	// SplitPatterns, hidden from json output and only accepted through the
+	// input structs. DefaultSensitive is used when nil.
+	Sensitive []string
+	// Progress, when set, is called after each introspected batch.
+	Progress func(stage string, done, total int)
+}
+
+const (
+	DefaultWorkers   = 4
+	DefaultBatchSize = 100
+)
+
+// DefaultSensitive are the column patterns treated as sensitive by default.
+var DefaultSensitive = []string{
+	"password", "*_password", "password_*",
+	"secret", "*_secret", "secret_*",
+	"token", "*_token",
+	"api_key", "*_api_key",
+}
+
 var typeMappingMysql = map[string]string{
 	"int":                "int", // int signed
 	"integer":            "int",
@@ -117,6 +160,8 @@ var typeMappingPostgres = map[string]string{
 type Table struct {
 	Name          string
 	Pk            string
+	// PkType is the Go type of the primary key, int unless it is a string.
+	PkType        string
 	Uk            []string
 	Fk            map[string]*ForeignKey
 	Columns       []*Column
@@ -127,6 +172,8 @@ type Column struct {
 	Name string
 	Type string
 	Tag  *OrmTag
+	// refPkType is the PkType of the table referenced by a foreign key.
+	refPkType string
 }
 
 type ForeignKey struct {
@@ -155,6 +202,8 @@ type OrmTag struct {
 	RelFk       bool
 	ReverseMany bool
 	RelM2M      bool
+	// Sensitive columns are hidden from json output.
+	Sensitive   bool
 }
 
 func (tb *Table) String() string {
@@ -224,11 +273,138 @@ func (tag *OrmTag) String() string {
 	if len(ormOptions) == 0 {
 		return ""
 	}
-	return fmt.Sprintf("`orm:\"%s\" json:\"%s\"`", strings.Join(ormOptions, ";"), tag.Column)
+	jsonName := tag.Column
+	if tag.Sensitive {
+		jsonName = "-"
+	}
+	return fmt.Sprintf("`orm:\"%s\" json:\"%s\"`", strings.Join(ormOptions, ";"), jsonName)
+}
+
+// InputColumns returns the columns clients may set through the create and
+// update input structs, auto increment keys and timestamps are left out.
+func (tb *Table) InputColumns() (cols []*Column) {
+	for _, col := range tb.Columns {
+		if col.Tag == nil || col.Tag.Auto || col.Tag.AutoNow || col.Tag.AutoNowAdd {
+			continue
+		}
+		cols = append(cols, col)
+	}
+	return
+}
+
+// inputType returns the Go type of col in the input structs, foreign keys
+// being set by the id of the referenced row.
+func (col *Column) inputType() string {
+	if col.Tag.RelFk {
+		if col.refPkType == "" {
+			return "int"
+		}
+		return col.refPkType
+	}
+	return col.Type
+}
+
+// pkGoType returns the Go type of a primary key column of type t. Integer
+// keys of any size are int like the ids of the generated code, other keys
+// keep their type if it is a string.
+func pkGoType(t string) string {
+	if t == "string" {
+		return t
+	}
+	return "int"
+}
+
+// zeroLiteral returns the literal of the zero value of the primary key type t.
+func zeroLiteral(t string) string {
+	if t == "string" {
+		return `""`
+	}
+	return "0"
+}
+
+// markSensitive flags the plain columns whose name matches any of patterns,
+// primary and foreign keys are never hidden.
+func markSensitive(tables []*Table, patterns []string) {
+	compiled, _ := compilePatterns(patterns)
+	for _, tb := range tables {
+		for _, col := range tb.Columns {
+			if col.Tag == nil || col.Tag.Pk || col.Tag.Auto || col.Tag.RelFk {
+				continue
+			}
+			col.Tag.Sensitive = matchAny(compiled, col.Tag.Column)
+		}
+	}
+}
+
+// Appcode introspects the database described by opts and renders the models,
+// controllers and router of the selected tables. Nothing is written to disk,
+// see Result.Write.
+func Appcode(ctx context.Context, opts Options) (*Result, error) {
+	mode, err := parseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Sensitive == nil {
+		opts.Sensitive = DefaultSensitive
+	}
+	if _, err := compilePatterns(opts.Sensitive); err != nil {
+		return nil, err
+	}
+	var selectedTables map[string]bool
+	if len(opts.Tables) > 0 {
+		selectedTables = make(map[string]bool)
+		for _, v := range opts.Tables {
+			selectedTables[v] = true
+		}
+	}
+	trans, ok := dbDriver[opts.Driver]
+	switch {
+	case opts.Driver == "sqlite":
+		return nil, errors.New("generating app code from SQLite database is not supported yet")
+	case !ok:
+		return nil, fmt.Errorf("unknown database driver: %s, driver must be one of mysql, postgres or sqlite", opts.Driver)
+	}
+	if opts.Workers < 1 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	pkgPath := opts.PkgPath
+	if pkgPath == "" {
+		if pkgPath, err = getPackagePath(opts.AppPath); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open(opts.Driver, opts.Conn)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s database: %s, %s", opts.Driver, opts.Conn, err)
+	}
+	defer db.Close()
+	tableNames, err := trans.GetTableNames(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := getTableObjects(ctx, opts.Filter.Apply(tableNames), &opts, db, trans)
+	if err != nil {
+		return nil, err
+	}
+	markSensitive(tables, opts.Sensitive)
+	mvcPath := &MvcPath{
+		ModelPath:      "models",
+		ControllerPath: "controllers",
+		RouterPath:     "routers",
+	}
+	res := &Result{Tables: tables}
+	renderSourceFiles(res, pkgPath, tables, mode, mvcPath, selectedTables)
+	return res, nil
 }
 
-func GenerateAppcode(driver, connStr, level, tables, currpath string) {
-	var mode byte
+func parseLevel(level string) (mode byte, err error) {
 	switch level {
 	case "m":
 		mode = O_MODEL
@@ -239,117 +415,192 @@ func GenerateAppcode(driver, connStr, level, tables, currpath string) {
 	case "r":
 		mode = O_ROUTER
 	default:
-		helper.ColorLog("[ERRO] Invalid 'level' option: %s\n", level)
-		helper.ColorLog("[HINT] Level must be either m, mc or r\n")
-		os.Exit(2)
-	}
-	var selectedTables map[string]bool
-	if tables != "" {
-		selectedTables = make(map[string]bool)
-		for _, v := range strings.Split(tables, ",") {
-			selectedTables[v] = true
-		}
-	}
-	switch driver {
-	case "mysql":
-	case "postgres":
-	case "sqlite":
-		helper.ColorLog("[ERRO] Generating app code from SQLite database is not supported yet.\n")
-		os.Exit(2)
-	default:
-		helper.ColorLog("[ERRO] Unknown database driver: %s\n", driver)
-		helper.ColorLog("[HINT] Driver must be one of mysql, postgres or sqlite\n")
-		os.Exit(2)
+		err = fmt.Errorf("invalid 'level' option: %s, level must be either m, mc, r or all", level)
 	}
-	gen(driver, connStr, mode, selectedTables, currpath)
+	return
 }
 
-func gen(dbms, connStr string, mode byte, selectedTableNames map[string]bool, currpath string) {
-	db, err := sql.Open(dbms, connStr)
+func (*MysqlDB) GetTableNames(ctx context.Context, db *sql.DB) (tables []string, err error) {
+	rows, err := db.QueryContext(ctx, "SHOW TABLES")
 	if err != nil {
-		helper.ColorLog("[ERRO] Could not connect to %s database: %s, %s\n", dbms, connStr, err)
-		os.Exit(2)
-	}
-	defer db.Close()
-	if trans, ok := dbDriver[dbms]; ok {
-		helper.ColorLog("[INFO] Analyzing database tables...\n")
-		tableNames := trans.GetTableNames(db)
-		tables := getTableObjects(tableNames, db, trans)
-		mvcPath := new(MvcPath)
-		mvcPath.ModelPath = path.Join(currpath, "models")
-		mvcPath.ControllerPath = path.Join(currpath, "controllers")
-		mvcPath.RouterPath = path.Join(currpath, "routers")
-		createPaths(mode, mvcPath)
-		pkgPath := getPackagePath(currpath)
-		writeSourceFiles(pkgPath, tables, mode, mvcPath, selectedTableNames)
-	} else {
-		helper.ColorLog("[ERRO] Generating app code from %s database is not supported yet.\n", dbms)
-		os.Exit(2)
-	}
-}
-
-func (*MysqlDB) GetTableNames(db *sql.DB) (tables []string) {
-	rows, err := db.Query("SHOW TABLES")
-	if err != nil {
-		helper.ColorLog("[ERRO] Could not show tables\n")
-		helper.ColorLog("[HINT] Check your connection string\n")
-		os.Exit(2)
+		return nil, fmt.Errorf("could not show tables, check your connection string: %s", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
-			helper.ColorLog("[ERRO] Could not show tables\n")
-			os.Exit(2)
-		}
-		if name != "migrations" {
-			tables = append(tables, name)
+			return nil, fmt.Errorf("could not show tables: %s", err)
 		}
+		tables = append(tables, name)
 	}
-	return
+	return tables, rows.Err()
 }
 
-func getTableObjects(tableNames []string, db *sql.DB, dbTransformer DbTransformer) (tables []*Table) {
+func getTableObjects(ctx context.Context, tableNames []string, opts *Options, db *sql.DB, dbTransformer DbTransformer) (tables []*Table, err error) {
 	// if a table has a composite pk or doesn't have pk, we can't use it yet
 	// these tables will be put into blacklist so that other struct will not
 	// reference it.
 	blackList := make(map[string]bool)
-	// process constraints information for each table, also gather blacklisted table names
 	for _, tableName := range tableNames {
 		// create a table struct
 		tb := new(Table)
 		tb.Name = tableName
 		tb.Fk = make(map[string]*ForeignKey)
-		dbTransformer.GetConstraints(db, tb, blackList)
 		tables = append(tables, tb)
 	}
+	batches := batchTables(tables, opts.BatchSize)
+	// process constraints information for each batch, also gather blacklisted table names
+	var mu sync.Mutex
+	err = introspect(ctx, "constraints", batches, len(tables), opts, func(ctx context.Context, batch []*Table) error {
+		bl := make(map[string]bool)
+		if err := dbTransformer.GetConstraints(ctx, db, batch, bl); err != nil {
+			return err
+		}
+		mu.Lock()
+		for name := range bl {
+			blackList[name] = true
+		}
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// foreign keys to tables that were filtered out degrade to plain columns
+	for _, tb := range tables {
+		for name, fk := range tb.Fk {
+			if !opts.Filter.Match(fk.RefTable) {
+				delete(tb.Fk, name)
+			}
+		}
+	}
 	// process columns, ignoring blacklisted tables
+	err = introspect(ctx, "columns", batches, len(tables), opts, func(ctx context.Context, batch []*Table) error {
+		return dbTransformer.GetColumns(ctx, db, batch, blackList)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the referenced table of a foreign key may be in another batch
+	pkTypes := make(map[string]string)
 	for _, tb := range tables {
-		dbTransformer.GetColumns(db, tb, blackList)
+		pkTypes[tb.Name] = tb.PkType
+	}
+	for _, tb := range tables {
+		for _, col := range tb.Columns {
+			if col.Tag != nil && col.Tag.RelFk {
+				col.refPkType = pkTypes[tb.Fk[col.Tag.Column].RefTable]
+			}
+		}
+	}
+	return tables, nil
+}
+
+// batchTables splits tables into chunks of at most size tables each.
+func batchTables(tables []*Table, size int) (batches [][]*Table) {
+	if size < 1 {
+		size = len(tables)
+	}
+	for len(tables) > 0 {
+		n := size
+		if n > len(tables) {
+			n = len(tables)
+		}
+		batches = append(batches, tables[:n])
+		tables = tables[n:]
 	}
 	return
 }
 
-func (*MysqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
-	rows, err := db.Query(
-		`SELECT
-			c.constraint_type, u.column_name, u.referenced_table_schema, u.referenced_table_name, referenced_column_name, u.ordinal_position
-		FROM
-			information_schema.table_constraints c
-		INNER JOIN
-			information_schema.key_column_usage u ON c.constraint_name = u.constraint_name
-		WHERE
-			c.table_schema = database() AND c.table_name = ? AND u.table_schema = database() AND u.table_name = ?`,
-		table.Name, table.Name) //  u.position_in_unique_constraint,
-	if err != nil {
-		helper.ColorLog("[ERRO] Could not query INFORMATION_SCHEMA for PK/UK/FK information\n")
-		os.Exit(2)
+// introspect runs fn for every batch on a bounded pool of opts.Workers
+// goroutines and reports how many tables have been processed so far. The
+// first error cancels the remaining batches.
+func introspect(ctx context.Context, stage string, batches [][]*Table, total int, opts *Options, fn func(context.Context, []*Table) error) error {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(batches) {
+		workers = len(batches)
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	done := 0
+	queue := make(chan []*Table)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range queue {
+				err := fn(ctx, batch)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				done += len(batch)
+				if err == nil && opts.Progress != nil {
+					opts.Progress(stage, done, total)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, batch := range batches {
+		select {
+		case queue <- batch:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// indexTables returns the given tables keyed by name along with their names
+// as query arguments.
+func indexTables(tables []*Table) (index map[string]*Table, args []interface{}) {
+	index = make(map[string]*Table, len(tables))
+	for _, tb := range tables {
+		index[tb.Name] = tb
+		args = append(args, tb.Name)
+	}
+	return
+}
+
+// placeholders returns n comma separated bind parameters for the given driver.
+func placeholders(dbms string, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		if dbms == "postgres" {
+			params[i] = fmt.Sprintf("$%d", i + 1)
+		} else {
+			params[i] = "?"
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+// scanConstraints reads PK/UK/FK rows of several tables, the first column of
+// every row being the name of the table the constraint belongs to.
+func scanConstraints(rows *sql.Rows, index map[string]*Table, blackList map[string]bool) error {
 	for rows.Next() {
-		var constraintTypeBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
-		if err := rows.Scan(&constraintTypeBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
-			helper.ColorLog("[ERRO] Could not read INFORMATION_SCHEMA for PK/UK/FK information\n")
-			os.Exit(2)
+		var tableNameBytes, constraintTypeBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
+		if err := rows.Scan(&tableNameBytes, &constraintTypeBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
+			return fmt.Errorf("could not read INFORMATION_SCHEMA for PK/UK/FK information: %s", err)
+		}
+		table, ok := index[string(tableNameBytes)]
+		if !ok {
+			continue
 		}
 		constraintType, columnName, refTableSchema, refTableName, refColumnName, refOrdinalPos :=
 		string(constraintTypeBytes), string(columnNameBytes), string(refTableSchemaBytes),
@@ -374,38 +625,70 @@ func (*MysqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bo
 			table.Fk[columnName] = fk
 		}
 	}
+	return rows.Err()
+}
+
+func (*MysqlDB) GetConstraints(ctx context.Context, db *sql.DB, tables []*Table, blackList map[string]bool) error {
+	index, args := indexTables(tables)
+	rows, err := db.QueryContext(ctx,
+		`SELECT
+			c.table_name, c.constraint_type, u.column_name, u.referenced_table_schema, u.referenced_table_name, referenced_column_name, u.ordinal_position
+		FROM
+			information_schema.table_constraints c
+		INNER JOIN
+			information_schema.key_column_usage u ON c.constraint_name = u.constraint_name AND c.table_name = u.table_name
+		WHERE
+			c.table_schema = database() AND u.table_schema = database() AND c.table_name IN (` + placeholders("mysql", len(args)) + `)`,
+		args...) //  u.position_in_unique_constraint,
+	if err != nil {
+		return fmt.Errorf("could not query INFORMATION_SCHEMA for PK/UK/FK information: %s", err)
+	}
+	defer rows.Close()
+	return scanConstraints(rows, index, blackList)
 }
 
-func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+func (mysqlDB *MysqlDB) GetColumns(ctx context.Context, db *sql.DB, tables []*Table, blackList map[string]bool) error {
+	index, args := indexTables(tables)
 	// retrieve columns
-	colDefRows, _ := db.Query(
+	colDefRows, err := db.QueryContext(ctx,
 		`SELECT
-			column_name, data_type, column_type, is_nullable, column_default, extra
+			table_name, column_name, data_type, column_type, is_nullable, column_default, extra
 		FROM
 			information_schema.columns
 		WHERE
-			table_schema = database() AND table_name = ?`,
-		table.Name)
+			table_schema = database() AND table_name IN (` + placeholders("mysql", len(args)) + `)
+		ORDER BY
+			table_name, ordinal_position`,
+		args...)
+	if err != nil {
+		return fmt.Errorf("could not query INFORMATION_SCHEMA for column information: %s", err)
+	}
 	defer colDefRows.Close()
 	for colDefRows.Next() {
 		// datatype as bytes so that SQL <null> values can be retrieved
-		var colNameBytes, dataTypeBytes, columnTypeBytes, isNullableBytes, columnDefaultBytes, extraBytes []byte
-		if err := colDefRows.Scan(&colNameBytes, &dataTypeBytes, &columnTypeBytes, &isNullableBytes, &columnDefaultBytes, &extraBytes); err != nil {
-			helper.ColorLog("[ERRO] Could not query INFORMATION_SCHEMA for column information\n")
-			os.Exit(2)
+		var tableNameBytes, colNameBytes, dataTypeBytes, columnTypeBytes, isNullableBytes, columnDefaultBytes, extraBytes []byte
+		if err := colDefRows.Scan(&tableNameBytes, &colNameBytes, &dataTypeBytes, &columnTypeBytes, &isNullableBytes, &columnDefaultBytes, &extraBytes); err != nil {
+			return fmt.Errorf("could not read INFORMATION_SCHEMA for column information: %s", err)
+		}
+		table, ok := index[string(tableNameBytes)]
+		if !ok {
+			continue
 		}
 		colName, dataType, columnType, isNullable, columnDefault, extra :=
 		string(colNameBytes), string(dataTypeBytes), string(columnTypeBytes), string(isNullableBytes), string(columnDefaultBytes), string(extraBytes)
 		// create a column
 		col := new(Column)
 		col.Name = camelCase(colName)
-		col.Type = mysqlDB.GetGoDataType(dataType)
+		if col.Type, err = mysqlDB.GetGoDataType(dataType); err != nil {
+			return err
+		}
 		// Tag info
 		tag := new(OrmTag)
 		tag.Column = colName
 		if table.Pk == colName {
 			col.Name = "Id"
-			col.Type = "int"
+			col.Type = pkGoType(col.Type)
+			table.PkType = col.Type
 			if extra == "auto_increment" {
 				tag.Auto = true
 			} else {
@@ -441,7 +724,9 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 				if isSQLSignedIntType(dataType) {
 					sign := extractIntSignness(columnType)
 					if sign == "unsigned" && extra != "auto_increment" {
-						col.Type = mysqlDB.GetGoDataType(dataType + " " + sign)
+						if col.Type, err = mysqlDB.GetGoDataType(dataType + " " + sign); err != nil {
+							return err
+						}
 					}
 				}
 				if isSQLStringType(dataType) {
@@ -450,12 +735,7 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 				if isSQLTemporalType(dataType) {
 					tag.Type = dataType
 					//check auto_now, auto_now_add
-					if columnDefault == "CURRENT_TIMESTAMP" && extra == "on update CURRENT_TIMESTAMP" {
-						tag.AutoNow = true
-					}
-					// else if columnDefault == "CURRENT_TIMESTAMP" {
-					// 	tag.AutoNowAdd = true
-					// }
+					tag.AutoNow, tag.AutoNowAdd = autoTimestamp(columnDefault, extra)
 					// need to import time package
 					table.ImportTimePkg = true
 				}
@@ -473,42 +753,39 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 		col.Tag = tag
 		table.Columns = append(table.Columns, col)
 	}
+	return colDefRows.Err()
 }
 
-func (*MysqlDB) GetGoDataType(sqlType string) (goType string) {
+func (*MysqlDB) GetGoDataType(sqlType string) (goType string, err error) {
 	if v, ok := typeMappingMysql[sqlType]; ok {
-		return v
-	} else {
-		helper.ColorLog("[ERRO] data type (%s) not found!\n", sqlType)
-		os.Exit(2)
+		return v, nil
 	}
-	return goType
+	return "", fmt.Errorf("data type (%s) not found", sqlType)
 }
 
-func (*PostgresDB) GetTableNames(db *sql.DB) (tables []string) {
-	rows, err := db.Query(`
+func (*PostgresDB) GetTableNames(ctx context.Context, db *sql.DB) (tables []string, err error) {
+	rows, err := db.QueryContext(ctx, `
 		SELECT table_name FROM information_schema.tables
 		WHERE table_catalog = current_database() and table_schema = 'public'`)
 	if err != nil {
-		helper.ColorLog("[ERRO] Could not show tables: %s\n", err)
-		helper.ColorLog("[HINT] Check your connection string\n")
-		os.Exit(2)
+		return nil, fmt.Errorf("could not show tables, check your connection string: %s", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
-			helper.ColorLog("[ERRO] Could not show tables\n")
-			os.Exit(2)
+			return nil, fmt.Errorf("could not show tables: %s", err)
 		}
 		tables = append(tables, name)
 	}
-	return
+	return tables, rows.Err()
 }
 
-func (*PostgresDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
-	rows, err := db.Query(
+func (*PostgresDB) GetConstraints(ctx context.Context, db *sql.DB, tables []*Table, blackList map[string]bool) error {
+	index, args := indexTables(tables)
+	rows, err := db.QueryContext(ctx,
 		`SELECT
+			c.table_name,
 			c.constraint_type,
 			u.column_name,
 			cu.table_catalog AS referenced_table_catalog,
@@ -518,52 +795,26 @@ func (*PostgresDB) GetConstraints(db *sql.DB, table *Table, blackList map[string
 		FROM
 			information_schema.table_constraints c
 		INNER JOIN
-			information_schema.key_column_usage u ON c.constraint_name = u.constraint_name
+			information_schema.key_column_usage u ON c.constraint_name = u.constraint_name AND c.table_name = u.table_name
 		INNER JOIN
 			information_schema.constraint_column_usage cu ON cu.constraint_name =  c.constraint_name
 		WHERE
-			c.table_catalog = current_database() AND c.table_schema = 'public' AND c.table_name = $1
-			AND u.table_catalog = current_database() AND u.table_schema = 'public' AND u.table_name = $2`,
-		table.Name, table.Name) //  u.position_in_unique_constraint,
+			c.table_catalog = current_database() AND c.table_schema = 'public' AND c.table_name IN (` + placeholders("postgres", len(args)) + `)
+			AND u.table_catalog = current_database() AND u.table_schema = 'public'`,
+		args...) //  u.position_in_unique_constraint,
 	if err != nil {
-		helper.ColorLog("[ERRO] Could not query INFORMATION_SCHEMA for PK/UK/FK information: %s\n", err)
-		os.Exit(2)
-	}
-	for rows.Next() {
-		var constraintTypeBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
-		if err := rows.Scan(&constraintTypeBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
-			helper.ColorLog("[ERRO] Could not read INFORMATION_SCHEMA for PK/UK/FK information\n")
-			os.Exit(2)
-		}
-		constraintType, columnName, refTableSchema, refTableName, refColumnName, refOrdinalPos :=
-		string(constraintTypeBytes), string(columnNameBytes), string(refTableSchemaBytes),
-		string(refTableNameBytes), string(refColumnNameBytes), string(refOrdinalPosBytes)
-		if constraintType == "PRIMARY KEY" {
-			if refOrdinalPos == "1" {
-				table.Pk = columnName
-			} else {
-				table.Pk = ""
-				// add table to blacklist so that other struct will not reference it, because we are not
-				// registering blacklisted tables
-				blackList[table.Name] = true
-			}
-		} else if constraintType == "UNIQUE" {
-			table.Uk = append(table.Uk, columnName)
-		} else if constraintType == "FOREIGN KEY" {
-			fk := new(ForeignKey)
-			fk.Name = columnName
-			fk.RefSchema = refTableSchema
-			fk.RefTable = refTableName
-			fk.RefColumn = refColumnName
-			table.Fk[columnName] = fk
-		}
+		return fmt.Errorf("could not query INFORMATION_SCHEMA for PK/UK/FK information: %s", err)
 	}
+	defer rows.Close()
+	return scanConstraints(rows, index, blackList)
 }
 
-func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
+func (postgresDB *PostgresDB) GetColumns(ctx context.Context, db *sql.DB, tables []*Table, blackList map[string]bool) error {
+	index, args := indexTables(tables)
 	// retrieve columns
-	colDefRows, _ := db.Query(
+	colDefRows, err := db.QueryContext(ctx,
 		`SELECT
+			table_name,
 			column_name,
 			data_type,
 			data_type ||
@@ -574,32 +825,48 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 			END AS column_type,
 			is_nullable,
 			column_default,
-			'' AS extra
+			is_identity AS extra
 		FROM
 			information_schema.columns
 		WHERE
-			table_catalog = current_database() AND table_schema = 'public' AND table_name = $1`,
-		table.Name)
+			table_catalog = current_database() AND table_schema = 'public' AND table_name IN (` + placeholders("postgres", len(args)) + `)
+		ORDER BY
+			table_name, ordinal_position`,
+		args...)
+	if err != nil {
+		return fmt.Errorf("could not query INFORMATION_SCHEMA for column information: %s", err)
+	}
 	defer colDefRows.Close()
 	for colDefRows.Next() {
 		// datatype as bytes so that SQL <null> values can be retrieved
-		var colNameBytes, dataTypeBytes, columnTypeBytes, isNullableBytes, columnDefaultBytes, extraBytes []byte
-		if err := colDefRows.Scan(&colNameBytes, &dataTypeBytes, &columnTypeBytes, &isNullableBytes, &columnDefaultBytes, &extraBytes); err != nil {
-			helper.ColorLog("[ERRO] Could not query INFORMATION_SCHEMA for column information\n")
-			os.Exit(2)
+		var tableNameBytes, colNameBytes, dataTypeBytes, columnTypeBytes, isNullableBytes, columnDefaultBytes, extraBytes []byte
+		if err := colDefRows.Scan(&tableNameBytes, &colNameBytes, &dataTypeBytes, &columnTypeBytes, &isNullableBytes, &columnDefaultBytes, &extraBytes); err != nil {
+			return fmt.Errorf("could not read INFORMATION_SCHEMA for column information: %s", err)
+		}
+		table, ok := index[string(tableNameBytes)]
+		if !ok {
+			continue
 		}
 		colName, dataType, columnType, isNullable, columnDefault, extra :=
 		string(colNameBytes), string(dataTypeBytes), string(columnTypeBytes), string(isNullableBytes), string(columnDefaultBytes), string(extraBytes)
+		// serial and identity columns are set by the database like the
+		// auto_increment ones of mysql
+		if extra == "YES" || strings.HasPrefix(columnDefault, "nextval(") {
+			extra = "auto_increment"
+		}
 		// create a column
 		col := new(Column)
 		col.Name = camelCase(colName)
-		col.Type = postgresDB.GetGoDataType(dataType)
+		if col.Type, err = postgresDB.GetGoDataType(dataType); err != nil {
+			return err
+		}
 		// Tag info
 		tag := new(OrmTag)
 		tag.Column = colName
 		if table.Pk == colName {
 			col.Name = "Id"
-			col.Type = "int"
+			col.Type = pkGoType(col.Type)
+			table.PkType = col.Type
 			if extra == "auto_increment" {
 				tag.Auto = true
 			} else {
@@ -631,11 +898,7 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 				if isSQLTemporalType(dataType) || strings.HasPrefix(dataType, "timestamp") {
 					tag.Type = dataType
 					//check auto_now, auto_now_add
-					if columnDefault == "CURRENT_TIMESTAMP" && extra == "on update CURRENT_TIMESTAMP" {
-						tag.AutoNow = true
-					} else if columnDefault == "CURRENT_TIMESTAMP" {
-						tag.AutoNowAdd = true
-					}
+					tag.AutoNow, tag.AutoNowAdd = autoTimestamp(columnDefault, extra)
 					// need to import time package
 					table.ImportTimePkg = true
 				}
@@ -653,46 +916,29 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 		col.Tag = tag
 		table.Columns = append(table.Columns, col)
 	}
+	return colDefRows.Err()
 }
 
-func (*PostgresDB) GetGoDataType(sqlType string) (goType string) {
+func (*PostgresDB) GetGoDataType(sqlType string) (goType string, err error) {
 	if v, ok := typeMappingPostgres[sqlType]; ok {
-		return v
-	} else {
-		helper.ColorLog("[ERRO] data type (%s) not found!\n", sqlType)
-		os.Exit(2)
-	}
-	return goType
-}
-
-func createPaths(mode byte, paths *MvcPath) {
-	if (mode & O_MODEL) == O_MODEL {
-		os.Mkdir(paths.ModelPath, 0777)
-	}
-	if (mode & O_CONTROLLER) == O_CONTROLLER {
-		os.Mkdir(paths.ControllerPath, 0777)
-	}
-	if (mode & O_ROUTER) == O_ROUTER {
-		os.Mkdir(paths.RouterPath, 0777)
+		return v, nil
 	}
+	return "", fmt.Errorf("data type (%s) not found", sqlType)
 }
 
-func writeSourceFiles(pkgPath string, tables []*Table, mode byte, paths *MvcPath, selectedTables map[string]bool) {
+func renderSourceFiles(res *Result, pkgPath string, tables []*Table, mode byte, paths *MvcPath, selectedTables map[string]bool) {
 	if (O_MODEL & mode) == O_MODEL {
-		helper.ColorLog("[INFO] Creating model files...\n")
-		writeModelFiles(tables, paths.ModelPath, selectedTables, pkgPath)
+		renderModelFiles(res, tables, paths.ModelPath, selectedTables, pkgPath)
 	}
 	if (O_CONTROLLER & mode) == O_CONTROLLER {
-		helper.ColorLog("[INFO] Creating controller files...\n")
-		writeControllerFiles(tables, paths.ControllerPath, selectedTables, pkgPath)
+		renderControllerFiles(res, tables, paths.ControllerPath, selectedTables, pkgPath)
 	}
 	if (O_ROUTER & mode) == O_ROUTER {
-		helper.ColorLog("[INFO] Creating router files...\n")
-		writeRouterFile(tables, paths.RouterPath, selectedTables, pkgPath)
+		renderRouterFile(res, tables, paths.RouterPath, selectedTables, pkgPath)
 	}
 }
 
-func writeModelFiles(tables []*Table, mPath string, selectedTables map[string]bool, pkgPath string) {
+func renderModelFiles(res *Result, tables []*Table, mPath string, selectedTables map[string]bool, pkgPath string) {
 	for _, tb := range tables {
 		// if selectedTables map is not nil and this table is not selected, ignore it
 		if selectedTables != nil {
@@ -700,29 +946,6 @@ func writeModelFiles(tables []*Table, mPath string, selectedTables map[string]bo
 				continue
 			}
 		}
-		filename := getFileName(tb.Name)
-		fpath := path.Join(mPath, filename + ".go")
-		var f *os.File
-		var err error
-		if helper.IsExist(fpath) {
-			helper.ColorLog("[WARN] %v is exist, do you want to overwrite it? Yes or No?\n", fpath)
-			if helper.AskForConfirmation() {
-				f, err = os.OpenFile(fpath, os.O_RDWR | os.O_TRUNC, 0666)
-				if err != nil {
-					helper.ColorLog("[WARN] %v\n", err)
-					continue
-				}
-			} else {
-				helper.ColorLog("[WARN] skip create file\n")
-				continue
-			}
-		} else {
-			f, err = os.OpenFile(fpath, os.O_CREATE | os.O_RDWR, 0666)
-			if err != nil {
-				helper.ColorLog("[WARN] %v\n", err)
-				continue
-			}
-		}
 		template := ""
 		if tb.Pk == "" {
 			template = stubs.TemplateModel(false)
@@ -742,20 +965,39 @@ func writeModelFiles(tables []*Table, mPath string, selectedTables map[string]bo
 		}
 
 		fileStr = strings.Replace(fileStr, "{{pkgPath}}", pkgPath, -1)
+		fileStr = strings.Replace(fileStr, "{{pkType}}", tb.PkType, -1)
 		fileStr = strings.Replace(fileStr, "{{timePkg}}", timePkg, -1)
 		fileStr = strings.Replace(fileStr, "{{importTimePkg}}", importTimePkg, -1)
 
-		if _, err := f.WriteString(fileStr); err != nil {
-			helper.ColorLog("[ERRO] Could not write model file to %s\n", fpath)
-			os.Exit(2)
+		createFields, createCopy, updateFields, updateCopy := "", "", "", ""
+		for _, col := range tb.InputColumns() {
+			createFields += fmt.Sprintf("%s %s `json:\"%s\"`\n", col.Name, col.inputType(), col.Tag.Column)
+			if col.Tag.RelFk {
+				createCopy += fmt.Sprintf("if in.%[1]s != %[3]s {\nm.%[1]s = &%[2]s{Id: in.%[1]s}\n}\n", col.Name, strings.TrimPrefix(col.Type, "*"), zeroLiteral(col.inputType()))
+			} else {
+				createCopy += fmt.Sprintf("m.%[1]s = in.%[1]s\n", col.Name)
+			}
+			// the primary key of an update comes from the url
+			if col.Tag.Pk {
+				continue
+			}
+			updateFields += fmt.Sprintf("%s *%s `json:\"%s\"`\n", col.Name, col.inputType(), col.Tag.Column)
+			if col.Tag.RelFk {
+				updateCopy += fmt.Sprintf("if in.%[1]s != nil {\nm.%[1]s = nil\nif *in.%[1]s != %[4]s {\nm.%[1]s = &%[2]s{Id: *in.%[1]s}\n}\nkeys = append(keys, \"%[3]s\")\n}\n", col.Name, strings.TrimPrefix(col.Type, "*"), col.Tag.Column, zeroLiteral(col.inputType()))
+			} else {
+				updateCopy += fmt.Sprintf("if in.%[1]s != nil {\nm.%[1]s = *in.%[1]s\nkeys = append(keys, \"%[2]s\")\n}\n", col.Name, col.Tag.Column)
+			}
 		}
-		f.Close()
-		helper.ColorLog("[INFO] model => %s\n", fpath)
-		formatSourceCode(fpath)
+		fileStr = strings.Replace(fileStr, "{{createFields}}", createFields, -1)
+		fileStr = strings.Replace(fileStr, "{{createCopy}}", createCopy, -1)
+		fileStr = strings.Replace(fileStr, "{{updateFields}}", updateFields, -1)
+		fileStr = strings.Replace(fileStr, "{{updateCopy}}", updateCopy, -1)
+
+		res.add("model", path.Join(mPath, getFileName(tb.Name) + ".go"), fileStr)
 	}
 }
 
-func writeControllerFiles(tables []*Table, cPath string, selectedTables map[string]bool, pkgPath string) {
+func renderControllerFiles(res *Result, tables []*Table, cPath string, selectedTables map[string]bool, pkgPath string) {
 	for _, tb := range tables {
 		if selectedTables != nil {
 			if _, selected := selectedTables[tb.Name]; !selected {
@@ -765,43 +1007,21 @@ func writeControllerFiles(tables []*Table, cPath string, selectedTables map[stri
 		if tb.Pk == "" {
 			continue
 		}
-		filename := getFileName(tb.Name)
-		fpath := path.Join(cPath, filename + ".go")
-		var f *os.File
-		var err error
-		if helper.IsExist(fpath) {
-			helper.ColorLog("[WARN] %v is exist, do you want to overwrite it? Yes or No?\n", fpath)
-			if helper.AskForConfirmation() {
-				f, err = os.OpenFile(fpath, os.O_RDWR | os.O_TRUNC, 0666)
-				if err != nil {
-					helper.ColorLog("[WARN] %v\n", err)
-					continue
-				}
-			} else {
-				helper.ColorLog("[WARN] skip create file\n")
-				continue
-			}
-		} else {
-			f, err = os.OpenFile(fpath, os.O_CREATE | os.O_RDWR, 0666)
-			if err != nil {
-				helper.ColorLog("[WARN] %v\n", err)
-				continue
-			}
-		}
 
+		strconvPkg, parseId := "\"strconv\"", "id, _ := strconv.Atoi(idStr)"
+		if tb.PkType == "string" {
+			strconvPkg, parseId = "", "id := idStr"
+		}
 		fileStr := strings.Replace(stubs.TemplateController(), "{{ctrlName}}", camelCase(tb.Name), -1)
 		fileStr = strings.Replace(fileStr, "{{pkgPath}}", pkgPath, -1)
-		if _, err := f.WriteString(fileStr); err != nil {
-			helper.ColorLog("[ERRO] Could not write controller file to %s\n", fpath)
-			os.Exit(2)
-		}
-		f.Close()
-		helper.ColorLog("[INFO] controller => %s\n", fpath)
-		formatSourceCode(fpath)
+		fileStr = strings.Replace(fileStr, "{{pkType}}", tb.PkType, -1)
+		fileStr = strings.Replace(fileStr, "{{strconvPkg}}", strconvPkg, -1)
+		fileStr = strings.Replace(fileStr, "{{parseId}}", parseId, -1)
+		res.add("controller", path.Join(cPath, getFileName(tb.Name) + ".go"), fileStr)
 	}
 }
 
-func writeRouterFile(tables []*Table, rPath string, selectedTables map[string]bool, pkgPath string) {
+func renderRouterFile(res *Result, tables []*Table, rPath string, selectedTables map[string]bool, pkgPath string) {
 	var nameSpaces []string
 	for _, tb := range tables {
 		// if selectedTables map is not nil and this table is not selected, ignore it
@@ -821,44 +1041,9 @@ func writeRouterFile(tables []*Table, rPath string, selectedTables map[string]bo
 	}
 
 	// add export controller
-	fpath := path.Join(rPath, "router.go")
 	routerStr := strings.Replace(stubs.TemplateRouter(), "{{nameSpaces}}", strings.Join(nameSpaces, ""), 1)
 	routerStr = strings.Replace(routerStr, "{{pkgPath}}", pkgPath, 1)
-	var f *os.File
-	var err error
-	if helper.IsExist(fpath) {
-		helper.ColorLog("[WARN] %v is exist, do you want to overwrite it? Yes or No?\n", fpath)
-		if helper.AskForConfirmation() {
-			f, err = os.OpenFile(fpath, os.O_RDWR | os.O_TRUNC, 0666)
-			if err != nil {
-				helper.ColorLog("[WARN] %v\n", err)
-				return
-			}
-		} else {
-			helper.ColorLog("[WARN] skip create file\n")
-			return
-		}
-	} else {
-		f, err = os.OpenFile(fpath, os.O_CREATE | os.O_RDWR, 0666)
-		if err != nil {
-			helper.ColorLog("[WARN] %v\n", err)
-			return
-		}
-	}
-	if _, err := f.WriteString(routerStr); err != nil {
-		helper.ColorLog("[ERRO] Could not write router file to %s\n", fpath)
-		os.Exit(2)
-	}
-	f.Close()
-	helper.ColorLog("[INFO] router => %s\n", fpath)
-	formatSourceCode(fpath)
-}
-
-func formatSourceCode(filename string) {
-	cmd := exec.Command("gofmt", "-w", filename)
-	if err := cmd.Run(); err != nil {
-		helper.ColorLog("[WARN] gofmt err: %s\n", err)
-	}
+	res.add("router", path.Join(rPath, "router.go"), routerStr)
 }
 
 func camelCase(in string) string {
@@ -869,6 +1054,24 @@ func camelCase(in string) string {
 	return strings.Join(tokens, "")
 }
 
+// autoTimestamp reports whether a temporal column with the default def and
+// the extra information of mysql is set to the current time on each update,
+// now, or on insert only, add.
+func autoTimestamp(def, extra string) (now, add bool) {
+	def = strings.ToLower(strings.TrimSpace(def))
+	// e.g. CURRENT_TIMESTAMP(3), current_timestamp() of mariadb, now() of postgres
+	if i := strings.Index(def, "("); i >= 0 && strings.HasSuffix(def, ")") {
+		def = def[:i]
+	}
+	if def != "current_timestamp" && def != "now" && def != "localtimestamp" {
+		return false, false
+	}
+	if strings.Contains(strings.ToLower(extra), "on update current_timestamp") {
+		return true, false
+	}
+	return false, true
+}
+
 func isSQLTemporalType(t string) bool {
 	return t == "date" || t == "datetime" || t == "timestamp" || t == "time"
 }
@@ -900,18 +1103,27 @@ func isSQLStrangeType(t string) bool {
 func extractColSize(colType string) string {
 	regex := regexp.MustCompile(`^[a-z]+\(([0-9]+)\)$`)
 	size := regex.FindStringSubmatch(colType)
+	if size == nil {
+		return ""
+	}
 	return size[1]
 }
 
 func extractIntSignness(colType string) string {
 	regex := regexp.MustCompile(`(int|smallint|mediumint|bigint)\([0-9]+\)(.*)`)
 	signRegex := regex.FindStringSubmatch(colType)
+	if signRegex == nil {
+		return ""
+	}
 	return strings.Trim(signRegex[2], " ")
 }
 
 func extractDecimal(colType string) (digits string, decimals string) {
 	decimalRegex := regexp.MustCompile(`decimal\(([0-9]+),([0-9]+)\)`)
 	decimal := decimalRegex.FindStringSubmatch(colType)
+	if decimal == nil {
+		return
+	}
 	digits, decimals = decimal[1], decimal[2]
 	return
 }
@@ -926,12 +1138,11 @@ func getFileName(tbName string) (filename string) {
 	return
 }
 
-func getPackagePath(curpath string) (packpath string) {
+func getPackagePath(curpath string) (packpath string, err error) {
 	gopath := os.Getenv("GOPATH")
 	helper.Debugf("gopath:%s", gopath)
 	if gopath == "" {
-		helper.ColorLog("[ERRO] you should set GOPATH in the env")
-		os.Exit(2)
+		return "", errors.New("you should set GOPATH in the env")
 	}
 
 	appsrcpath := ""
@@ -949,9 +1160,8 @@ func getPackagePath(curpath string) (packpath string) {
 	}
 
 	if !haspath {
-		helper.ColorLog("[ERRO] Can't generate application code outside of GOPATH '%s'\n", gopath)
-		os.Exit(2)
+		return "", fmt.Errorf("can't generate application code outside of GOPATH '%s'", gopath)
 	}
 	packpath = strings.Join(strings.Split(curpath[len(appsrcpath) + 1:], string(filepath.Separator)), "/")
-	return
+	return packpath, nil
 }
@@ -0,0 +1,498 @@
+package generator
+
+import (
+	"io"
+	"fmt"
+	"sort"
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"database/sql"
+	"database/sql/driver"
+)
+
+// schemaFixture holds fixed information_schema rows.
+type schemaFixture struct {
+	// constraints are rows of table_constraints: constraint_name,
+	// table_name and constraint_type.
+	constraints [][]string
+	// keyColumns are rows of key_column_usage: constraint_name, table_name,
+	// column_name, referenced_table_schema, referenced_table_name,
+	// referenced_column_name and ordinal_position.
+	keyColumns  [][]string
+	// columns are the rows of the columns queries, ordered by table and
+	// position.
+	columns     [][]string
+}
+
+// mysqlSchema names the primary keys of all the tables PRIMARY like mysql.
+var mysqlSchema = &schemaFixture{
+	constraints: [][]string{
+		{"PRIMARY", "users", "PRIMARY KEY"},
+		{"email", "users", "UNIQUE"},
+		{"users_ibfk_1", "users", "FOREIGN KEY"},
+		{"PRIMARY", "countries", "PRIMARY KEY"},
+		{"PRIMARY", "posts", "PRIMARY KEY"},
+		{"posts_ibfk_1", "posts", "FOREIGN KEY"},
+		{"posts_ibfk_2", "posts", "FOREIGN KEY"},
+		{"PRIMARY", "tags", "PRIMARY KEY"},
+		{"PRIMARY", "comments", "PRIMARY KEY"},
+		{"comments_ibfk_1", "comments", "FOREIGN KEY"},
+	},
+	keyColumns: [][]string{
+		{"PRIMARY", "users", "id", "", "", "", "1"},
+		{"email", "users", "email", "", "", "", "1"},
+		{"users_ibfk_1", "users", "country_code", "app", "countries", "code", "1"},
+		{"PRIMARY", "countries", "code", "", "", "", "1"},
+		{"PRIMARY", "posts", "id", "", "", "", "1"},
+		{"posts_ibfk_1", "posts", "user_id", "app", "users", "id", "1"},
+		{"posts_ibfk_2", "posts", "tag_id", "app", "tags", "id", "1"},
+		// composite primary key, tags is blacklisted
+		{"PRIMARY", "tags", "id", "", "", "", "1"},
+		{"PRIMARY", "tags", "lang", "", "", "", "2"},
+		{"PRIMARY", "comments", "id", "", "", "", "1"},
+		{"comments_ibfk_1", "comments", "post_id", "app", "posts", "id", "1"},
+	},
+	columns: [][]string{
+		{"comments", "id", "bigint", "bigint(20)", "NO", "", "auto_increment"},
+		{"comments", "post_id", "int", "int(11)", "YES", "", ""},
+		{"comments", "body", "text", "text", "NO", "", ""},
+		{"countries", "code", "char", "char(2)", "NO", "", ""},
+		{"countries", "name", "varchar", "varchar(64)", "NO", "", ""},
+		{"logs", "message", "varchar", "varchar(255)", "NO", "", ""},
+		{"logs", "created_at", "datetime", "datetime", "NO", "CURRENT_TIMESTAMP", "on update CURRENT_TIMESTAMP"},
+		{"posts", "id", "int", "int(11)", "NO", "", "auto_increment"},
+		{"posts", "user_id", "int", "int(11)", "NO", "", ""},
+		{"posts", "tag_id", "int", "int(11)", "NO", "", ""},
+		{"posts", "title", "varchar", "varchar(100)", "NO", "", ""},
+		{"posts", "price", "decimal", "decimal(10,2)", "NO", "", ""},
+		{"tags", "id", "int", "int(11)", "NO", "", ""},
+		{"tags", "lang", "char", "char(2)", "NO", "", ""},
+		{"users", "id", "int", "int(10) unsigned", "NO", "", "auto_increment"},
+		{"users", "email", "varchar", "varchar(64)", "NO", "", ""},
+		{"users", "password", "varchar", "varchar(64)", "NO", "", ""},
+		{"users", "country_code", "char", "char(2)", "YES", "", ""},
+		{"users", "created_at", "timestamp", "timestamp", "NO", "CURRENT_TIMESTAMP", "DEFAULT_GENERATED"},
+		{"users", "updated_at", "datetime", "datetime(3)", "NO", "CURRENT_TIMESTAMP(3)", "DEFAULT_GENERATED on update CURRENT_TIMESTAMP(3)"},
+	},
+}
+
+// postgresSchema has the referenced columns of constraint_column_usage in
+// keyColumns, and is_identity as the extra column of columns.
+var postgresSchema = &schemaFixture{
+	constraints: [][]string{
+		{"accounts_pkey", "accounts", "PRIMARY KEY"},
+		{"events_pkey", "events", "PRIMARY KEY"},
+		{"events_account_id_fkey", "events", "FOREIGN KEY"},
+		{"codes_pkey", "codes", "PRIMARY KEY"},
+	},
+	keyColumns: [][]string{
+		{"accounts_pkey", "accounts", "id", "", "", "", "1"},
+		{"events_pkey", "events", "id", "", "", "", "1"},
+		{"events_account_id_fkey", "events", "account_id", "app", "accounts", "id", "1"},
+		{"codes_pkey", "codes", "code", "", "", "", "1"},
+	},
+	columns: [][]string{
+		{"accounts", "id", "integer", "integer", "NO", "nextval('accounts_id_seq'::regclass)", "NO"},
+		{"accounts", "name", "character varying", "character varying", "NO", "", "NO"},
+		{"accounts", "created_at", "timestamp without time zone", "timestamp without time zone", "NO", "now()", "NO"},
+		{"codes", "code", "character varying", "character varying", "NO", "", "NO"},
+		{"events", "id", "bigint", "bigint", "NO", "", "YES"},
+		{"events", "account_id", "integer", "integer", "NO", "", "NO"},
+		{"events", "at", "timestamp", "timestamp", "NO", "CURRENT_TIMESTAMP", "NO"},
+	},
+}
+
+// schemaFixtures are the fixtures served for the data source names.
+var schemaFixtures = map[string]*schemaFixture{
+	"mysql":    mysqlSchema,
+	"postgres": postgresSchema,
+}
+
+// schemaDriver answers the information_schema queries with the
+// schemaFixtures of the data source name. Like the database, it keeps the
+// rows of the tables given as arguments and joins table_constraints and
+// key_column_usage on the constraint name, and on the table name only if
+// the query does.
+type schemaDriver struct{}
+
+func (schemaDriver) Open(name string) (driver.Conn, error) {
+	return schemaConn(name), nil
+}
+
+type schemaConn string
+
+func (c schemaConn) Prepare(query string) (driver.Stmt, error) {
+	return schemaStmt{query: query, fixture: schemaFixtures[string(c)]}, nil
+}
+
+func (schemaConn) Close() error {
+	return nil
+}
+
+func (schemaConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+type schemaStmt struct {
+	query   string
+	fixture *schemaFixture
+}
+
+func (schemaStmt) Close() error {
+	return nil
+}
+
+func (schemaStmt) NumInput() int {
+	return -1
+}
+
+func (schemaStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (s schemaStmt) Query(args []driver.Value) (driver.Rows, error) {
+	tables := make(map[string]bool)
+	for _, arg := range args {
+		tables[arg.(string)] = true
+	}
+	rows := &schemaResult{}
+	if !strings.Contains(s.query, "table_constraints") {
+		for _, row := range s.fixture.columns {
+			if tables[row[0]] {
+				rows.rows = append(rows.rows, row)
+			}
+		}
+		return rows, nil
+	}
+	joinTables := strings.Contains(s.query, "c.table_name = u.table_name")
+	for _, c := range s.fixture.constraints {
+		if !tables[c[1]] {
+			continue
+		}
+		for _, u := range s.fixture.keyColumns {
+			if u[0] != c[0] || (joinTables && u[1] != c[1]) {
+				continue
+			}
+			rows.rows = append(rows.rows, []string{c[1], c[2], u[2], u[3], u[4], u[5], u[6]})
+		}
+	}
+	return rows, nil
+}
+
+type schemaResult struct {
+	rows [][]string
+}
+
+func (*schemaResult) Columns() []string {
+	return make([]string, 7)
+}
+
+func (*schemaResult) Close() error {
+	return nil
+}
+
+func (r *schemaResult) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, v := range r.rows[0] {
+		dest[i] = []byte(v)
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("fire-schema", schemaDriver{})
+}
+
+// introspectSchema introspects the tables of the fixture dsn in batches of
+// batchSize tables on workers goroutines.
+func introspectSchema(t *testing.T, dsn string, names []string, batchSize, workers int) []*Table {
+	db, err := sql.Open("fire-schema", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	transformer := DbTransformer(&MysqlDB{})
+	if dsn == "postgres" {
+		transformer = &PostgresDB{}
+	}
+	opts := &Options{BatchSize: batchSize, Workers: workers}
+	tables, err := getTableObjects(context.Background(), names, opts, db, transformer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tables
+}
+
+// renderSchema introspects mysqlSchema in batches of batchSize tables on
+// workers goroutines and renders all the files.
+func renderSchema(t *testing.T, batchSize, workers int) *Result {
+	names := []string{"users", "posts", "tags", "comments", "logs", "countries"}
+	tables := introspectSchema(t, "mysql", names, batchSize, workers)
+	markSensitive(tables, DefaultSensitive)
+	res := &Result{Tables: tables}
+	paths := &MvcPath{ModelPath: "models", ControllerPath: "controllers", RouterPath: "routers"}
+	renderSourceFiles(res, "app", tables, O_MODEL | O_CONTROLLER | O_ROUTER, paths, nil)
+	return res
+}
+
+// baselineSchema is what the per table queries of fire before batching made
+// of mysqlSchema, apart from the auto timestamps of users and the string
+// primary key of countries, which they did not support.
+const baselineSchema = `users pk=id uk=[email] fk=[country_code:countries.code] time=true
+	Id int `+"`"+`orm:"column(id);auto" json:"id"`+"`"+`
+	Email string `+"`"+`orm:"column(email);size(64)" json:"email"`+"`"+`
+	Password string `+"`"+`orm:"column(password);size(64)" json:"password"`+"`"+`
+	CountryCode *Countries `+"`"+`orm:"column(country_code);null;rel(fk)" json:"country_code"`+"`"+`
+	CreatedAt time.Time `+"`"+`orm:"column(created_at);type(timestamp);auto_now_add" json:"created_at"`+"`"+`
+	UpdatedAt time.Time `+"`"+`orm:"column(updated_at);type(datetime);auto_now" json:"updated_at"`+"`"+`
+posts pk=id uk=[] fk=[tag_id:tags.id user_id:users.id] time=false
+	Id int `+"`"+`orm:"column(id);auto" json:"id"`+"`"+`
+	UserId *Users `+"`"+`orm:"column(user_id);rel(fk)" json:"user_id"`+"`"+`
+	TagId int `+"`"+`orm:"column(tag_id)" json:"tag_id"`+"`"+`
+	Title string `+"`"+`orm:"column(title);size(100)" json:"title"`+"`"+`
+	Price float64 `+"`"+`orm:"column(price);digits(10);decimals(2)" json:"price"`+"`"+`
+tags pk= uk=[] fk=[] time=false
+	Id_RENAME int `+"`"+`orm:"column(id)" json:"id"`+"`"+`
+	Lang string `+"`"+`orm:"column(lang);size(2)" json:"lang"`+"`"+`
+comments pk=id uk=[] fk=[post_id:posts.id] time=false
+	Id int `+"`"+`orm:"column(id);auto" json:"id"`+"`"+`
+	PostId *Posts `+"`"+`orm:"column(post_id);null;rel(fk)" json:"post_id"`+"`"+`
+	Body string `+"`"+`orm:"column(body)" json:"body"`+"`"+`
+logs pk= uk=[] fk=[] time=true
+	Message string `+"`"+`orm:"column(message);size(255)" json:"message"`+"`"+`
+	CreatedAt time.Time `+"`"+`orm:"column(created_at);type(datetime);auto_now" json:"created_at"`+"`"+`
+countries pk=code uk=[] fk=[] time=false
+	Id string `+"`"+`orm:"column(code);pk" json:"code"`+"`"+`
+	Name string `+"`"+`orm:"column(name);size(64)" json:"name"`+"`"+`
+`
+
+// describeTables lists the keys and the columns of tables.
+func describeTables(tables []*Table) string {
+	var buf bytes.Buffer
+	for _, tb := range tables {
+		var fks []string
+		for name, fk := range tb.Fk {
+			fks = append(fks, name + ":" + fk.RefTable + "." + fk.RefColumn)
+		}
+		sort.Strings(fks)
+		fmt.Fprintf(&buf, "%s pk=%s uk=%v fk=%v time=%t\n", tb.Name, tb.Pk, tb.Uk, fks, tb.ImportTimePkg)
+		for _, col := range tb.Columns {
+			fmt.Fprintf(&buf, "\t%s\n", col)
+		}
+	}
+	return buf.String()
+}
+
+func TestIntrospectionMatchesBaseline(t *testing.T) {
+	names := []string{"users", "posts", "tags", "comments", "logs", "countries"}
+	for _, c := range []struct{ batchSize, workers int }{{1, 1}, {2, 4}, {3, 2}, {100, 4}, {1, 8}} {
+		got := describeTables(introspectSchema(t, "mysql", names, c.batchSize, c.workers))
+		if got != baselineSchema {
+			t.Errorf("batch %d workers %d:\n%s\nwant:\n%s", c.batchSize, c.workers, got, baselineSchema)
+		}
+	}
+
+	// the rendered files do not depend on the batches either
+	perTable := renderSchema(t, 1, 1)
+	for _, w := range perTable.Warnings {
+		t.Errorf("per table: %s", w)
+	}
+	batched := renderSchema(t, 100, 4)
+	if len(batched.Files) != len(perTable.Files) {
+		t.Fatalf("%d files, want %d", len(batched.Files), len(perTable.Files))
+	}
+	for i, f := range perTable.Files {
+		if got := batched.Files[i]; got.Path != f.Path || !bytes.Equal(got.Content, f.Content) {
+			t.Errorf("%s differs from the per table output:\n%s\nwant:\n%s", got.Path, got.Content, f.Content)
+		}
+	}
+}
+
+func TestIntrospectionMergesConstraints(t *testing.T) {
+	// the batches are {users, posts}, {tags, comments} and {logs, countries}:
+	// the blacklist of the tags batch has to reach the columns of posts, and
+	// the foreign keys of users and comments reference the other batches
+	res := renderSchema(t, 2, 4)
+	tables := make(map[string]*Table)
+	for _, tb := range res.Tables {
+		tables[tb.Name] = tb
+	}
+	column := func(table, name string) *Column {
+		for _, col := range tables[table].Columns {
+			if col.Tag.Column == name {
+				return col
+			}
+		}
+		t.Fatalf("no column %s.%s", table, name)
+		return nil
+	}
+
+	if pk := tables["users"].Pk; pk != "id" {
+		t.Errorf("users pk = %q, want id", pk)
+	}
+	if uk := tables["users"].Uk; len(uk) != 1 || uk[0] != "email" {
+		t.Errorf("users uk = %v, want [email]", uk)
+	}
+	if pk := tables["tags"].Pk; pk != "" {
+		t.Errorf("tags has a composite pk, got pk %q", pk)
+	}
+	if col := column("posts", "user_id"); !col.Tag.RelFk || col.Type != "*Users" {
+		t.Errorf("posts.user_id = %s %v, want a foreign key to Users", col.Type, col.Tag.RelFk)
+	}
+	if col := column("posts", "tag_id"); col.Tag.RelFk || col.Type != "int" {
+		t.Errorf("posts.tag_id references a blacklisted table, got %s %v", col.Type, col.Tag.RelFk)
+	}
+	if col := column("comments", "post_id"); !col.Tag.RelFk || !col.Tag.Null || col.inputType() != "int" {
+		t.Errorf("comments.post_id = %s %s, want a nullable foreign key set by an int", col.Tag, col.inputType())
+	}
+	if col := column("users", "country_code"); !col.Tag.RelFk || col.Type != "*Countries" || col.inputType() != "string" {
+		t.Errorf("users.country_code = %s %s, want a foreign key to Countries set by a string", col.Type, col.inputType())
+	}
+	if col := column("users", "password"); !col.Tag.Sensitive {
+		t.Errorf("users.password is not sensitive")
+	}
+	if !tables["logs"].ImportTimePkg || tables["logs"].Pk != "" {
+		t.Errorf("logs = %+v, want no pk and the time package", tables["logs"])
+	}
+}
+
+func TestForeignKeyInputTypes(t *testing.T) {
+	// users and countries are in different batches
+	res := renderSchema(t, 1, 4)
+	files := make(map[string]string)
+	for _, f := range res.Files {
+		files[f.Path] = string(f.Content)
+	}
+	for _, w := range res.Warnings {
+		t.Errorf("warning: %s", w)
+	}
+
+	users := files["models/users.go"]
+	for _, want := range []string{
+		"CountryCode string `json:\"country_code\"`",
+		"if in.CountryCode != \"\" {",
+		"CountryCode *string `json:\"country_code\"`",
+		"if *in.CountryCode != \"\" {",
+		"func GetUsersById(id int)",
+	} {
+		if !strings.Contains(users, want) {
+			t.Errorf("models/users.go lacks %s:\n%s", want, users)
+		}
+	}
+	if posts := files["models/posts.go"]; !strings.Contains(posts, "UserId *int ") || !strings.Contains(posts, "if in.UserId != 0 {") {
+		t.Errorf("models/posts.go lacks an int user_id input:\n%s", posts)
+	}
+
+	if countries := files["models/countries.go"]; !strings.Contains(countries, "func GetCountriesById(id string)") {
+		t.Errorf("models/countries.go lacks a string id:\n%s", countries)
+	}
+	ctrl := files["controllers/countries.go"]
+	if !strings.Contains(ctrl, "id := idStr") || strings.Contains(ctrl, "strconv") {
+		t.Errorf("controllers/countries.go does not use the string id:\n%s", ctrl)
+	}
+	if ctrl := files["controllers/users.go"]; !strings.Contains(ctrl, "id, _ := strconv.Atoi(idStr)") {
+		t.Errorf("controllers/users.go does not parse the int id:\n%s", ctrl)
+	}
+}
+
+func TestSensitivePatterns(t *testing.T) {
+	cases := []struct {
+		list      string
+		sensitive []string
+	}{
+		{"password", []string{"password"}},
+		{"*_at", []string{"created_at", "updated_at"}},
+		{`/^(e|pass)[a-z]{3,5}$/`, []string{"email", "password"}},
+		{`/^pass/,name`, []string{"password", "name"}},
+		// primary and foreign keys are never hidden
+		{"/.*/,*_code", []string{"email", "password", "created_at", "updated_at", "name"}},
+	}
+	tables := introspectSchema(t, "mysql", []string{"users", "countries"}, 1, 1)
+	for _, c := range cases {
+		markSensitive(tables, SplitPatterns(c.list))
+		var got []string
+		for _, tb := range tables {
+			for _, col := range tb.Columns {
+				if col.Tag.Sensitive {
+					got = append(got, col.Tag.Column)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, c.sensitive) {
+			t.Errorf("%s: sensitive columns = %v, want %v", c.list, got, c.sensitive)
+		}
+	}
+}
+
+func TestAutoColumnsLeftOutOfInputs(t *testing.T) {
+	inputs := func(tables []*Table) map[string][]string {
+		cols := make(map[string][]string)
+		for _, tb := range tables {
+			for _, col := range tb.InputColumns() {
+				cols[tb.Name] = append(cols[tb.Name], col.Tag.Column)
+			}
+		}
+		return cols
+	}
+	cases := []struct {
+		dsn    string
+		names  []string
+		inputs map[string][]string
+	}{
+		{"mysql", []string{"users", "countries"}, map[string][]string{
+			"users":     {"email", "password", "country_code"},
+			"countries": {"code", "name"},
+		}},
+		{"postgres", []string{"accounts", "events", "codes"}, map[string][]string{
+			"accounts": {"name"},
+			"events":   {"account_id"},
+			"codes":    {"code"},
+		}},
+	}
+	for _, c := range cases {
+		got := inputs(introspectSchema(t, c.dsn, c.names, 1, 1))
+		if !reflect.DeepEqual(got, c.inputs) {
+			t.Errorf("%s: input columns = %v, want %v", c.dsn, got, c.inputs)
+		}
+	}
+
+	tables := introspectSchema(t, "mysql", []string{"users"}, 1, 1)
+	for _, col := range tables[0].Columns {
+		switch col.Tag.Column {
+		case "created_at":
+			if !col.Tag.AutoNowAdd || col.Tag.AutoNow {
+				t.Errorf("users.created_at = %s, want auto_now_add", col.Tag)
+			}
+		case "updated_at":
+			if !col.Tag.AutoNow || col.Tag.AutoNowAdd {
+				t.Errorf("users.updated_at = %s, want auto_now", col.Tag)
+			}
+		}
+	}
+}
+
+func TestAutoTimestamp(t *testing.T) {
+	cases := []struct {
+		def, extra string
+		now, add   bool
+	}{
+		{"CURRENT_TIMESTAMP", "on update CURRENT_TIMESTAMP", true, false},
+		{"CURRENT_TIMESTAMP", "", false, true},
+		{"current_timestamp()", "on update current_timestamp()", true, false},
+		{"CURRENT_TIMESTAMP(6)", "DEFAULT_GENERATED", false, true},
+		{"now()", "NO", false, true},
+		{"", "on update CURRENT_TIMESTAMP", false, false},
+		{"2000-01-01 00:00:00", "", false, false},
+	}
+	for _, c := range cases {
+		if now, add := autoTimestamp(c.def, c.extra); now != c.now || add != c.add {
+			t.Errorf("autoTimestamp(%q, %q) = %t, %t, want %t, %t", c.def, c.extra, now, add, c.now, c.add)
+		}
+	}
+}
@@ -9,21 +9,18 @@ import (
 	"regexp"
 	"reflect"
 	"runtime"
+	"context"
 	"strconv"
 	"strings"
 	"unicode"
-	"go/token"
-	"go/parser"
 	"encoding/json"
 	"path/filepath"
 
 	"github.com/qasico/fire/stubs"
-	"github.com/qasico/fire/helper"
 	"github.com/qasico/beego/utils"
 	"github.com/qasico/beego/swagger"
 )
 
-var globalDocsTemplate = ``
 const (
 	ajson = "application/json"
 	axml = "application/xml"
@@ -31,32 +28,66 @@ const (
 	ahtml = "text/html"
 )
 
-var pkgCache map[string]bool //pkg:controller:function:comments comments: key:value
-var controllerComments map[string]string
-var importlist map[string]string
-var apilist map[string]*swagger.APIDeclaration
-var controllerList map[string][]swagger.API
-var modelsList map[string]map[string]swagger.Model
-var rootapi swagger.ResourceListing
-
-func init() {
-	pkgCache = make(map[string]bool)
-	controllerComments = make(map[string]string)
-	importlist = make(map[string]string)
-	apilist = make(map[string]*swagger.APIDeclaration)
-	controllerList = make(map[string][]swagger.API)
-	modelsList = make(map[string]map[string]swagger.Model)
+// DocsOptions configures Docs.
+type DocsOptions struct {
+	// AppPath is the application root holding routers/router.go.
+	AppPath string
+	// Cache reuses the sources parsed by previous runs, optional.
+	Cache   *DocsCache
 }
 
-func GenerateDocs(curpath string) {
-	fset := token.NewFileSet()
+// docsParser holds the state of a single Docs run.
+type docsParser struct {
+	ctx                context.Context
+	appPath            string
+	cache              *DocsCache
+	pkgCache           map[string]bool //pkg:controller:function:comments comments: key:value
+	controllerComments map[string]string
+	importlist         map[string]string
+	apilist            map[string]*swagger.APIDeclaration
+	controllerList     map[string][]swagger.API
+	modelsList         map[string]map[string]swagger.Model
+	rootapi            swagger.ResourceListing
+}
+
+func newDocsParser(ctx context.Context, appPath string, cache *DocsCache) *docsParser {
+	if cache == nil {
+		cache = NewDocsCache()
+	}
+	return &docsParser{
+		ctx:                ctx,
+		appPath:            appPath,
+		cache:              cache,
+		pkgCache:           make(map[string]bool),
+		controllerComments: make(map[string]string),
+		importlist:         make(map[string]string),
+		apilist:            make(map[string]*swagger.APIDeclaration),
+		controllerList:     make(map[string][]swagger.API),
+		modelsList:         make(map[string]map[string]swagger.Model),
+	}
+}
+
+// Docs parses the router and the controllers it includes and renders the
+// swagger declarations as docs/docs.go. Nothing is written to disk, see
+// Result.Write.
+func Docs(ctx context.Context, opts DocsOptions) (*Result, error) {
+	p := newDocsParser(ctx, opts.AppPath, opts.Cache)
+	content, err := p.generate()
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{}
+	res.add("docs", path.Join("docs", "docs.go"), content)
+	return res, nil
+}
 
-	f, err := parser.ParseFile(fset, path.Join(curpath, "routers", "router.go"), nil, parser.ParseComments)
+func (p *docsParser) generate() (string, error) {
+	f, err := p.cache.parseFile(path.Join(p.appPath, "routers", "router.go"))
 
 	if err != nil {
-		helper.ColorLog("[ERRO] parse router.go error\n")
-		os.Exit(2)
+		return "", fmt.Errorf("parse router.go error: %s", err)
 	}
+	rootapi := &p.rootapi
 
 	rootapi.Info = swagger.Information{}
 	rootapi.SwaggerVersion = swagger.SwaggerVersion
@@ -87,7 +118,9 @@ func GenerateDocs(curpath string) {
 		if im.Name != nil {
 			localName = im.Name.Name
 		}
-		analisyscontrollerPkg(localName, im.Path.Value)
+		if err := p.analisyscontrollerPkg(localName, im.Path.Value); err != nil {
+			return "", err
+		}
 	}
 
 	globalDocsTemplate := stubs.TemplateDocs()
@@ -102,8 +135,8 @@ func GenerateDocs(curpath string) {
 						if v, ok := l.(*ast.CallExpr); ok {
 							f, params := analisysNewNamespace(v)
 							globalDocsTemplate = strings.Replace(globalDocsTemplate, "{{.version}}", f, -1)
-							for _, p := range params {
-								switch pp := p.(type) {
+							for _, param := range params {
+								switch pp := param.(type) {
 								case *ast.CallExpr:
 									if selname := pp.Fun.(*ast.SelectorExpr).Sel.String(); selname == "NSNamespace" {
 										s, params := analisysNewNamespace(pp)
@@ -113,16 +146,16 @@ func GenerateDocs(curpath string) {
 											switch pp := sp.(type) {
 											case *ast.CallExpr:
 												if pp.Fun.(*ast.SelectorExpr).Sel.String() == "NSInclude" {
-													controllerName = analisysNSInclude(s, pp)
+													controllerName = p.analisysNSInclude(s, pp)
 												}
 											}
 										}
-										if v, ok := controllerComments[controllerName]; ok {
+										if v, ok := p.controllerComments[controllerName]; ok {
 											subapi.Description = v
 										}
 										rootapi.APIs = append(rootapi.APIs, subapi)
 									} else if selname == "NSInclude" {
-										analisysNSInclude(f, pp)
+										p.analisysNSInclude(f, pp)
 									}
 								}
 							}
@@ -135,21 +168,15 @@ func GenerateDocs(curpath string) {
 	}
 	apiinfo, err := json.Marshal(rootapi)
 	if err != nil {
-		panic(err)
-	}
-	subapi, err := json.Marshal(apilist)
-	if err != nil {
-		panic(err)
+		return "", err
 	}
-	os.Mkdir(path.Join(curpath, "docs"), 0755)
-	fd, err := os.Create(path.Join(curpath, "docs", "docs.go"))
+	subapi, err := json.Marshal(p.apilist)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	defer fd.Close()
 	a := strings.Replace(globalDocsTemplate, "{{.rootinfo}}", "`" + string(apiinfo) + "`", -1)
 	a = strings.Replace(a, "{{.subapi}}", "`" + string(subapi) + "`", -1)
-	fd.WriteString(a)
+	return a, nil
 }
 
 func analisysNewNamespace(ce *ast.CallExpr) (first string, others []ast.Expr) {
@@ -166,54 +193,57 @@ func analisysNewNamespace(ce *ast.CallExpr) (first string, others []ast.Expr) {
 	return
 }
 
-func analisysNSInclude(baseurl string, ce *ast.CallExpr) string {
+func (p *docsParser) analisysNSInclude(baseurl string, ce *ast.CallExpr) string {
 	cname := ""
 	a := &swagger.APIDeclaration{}
-	a.APIVersion = rootapi.APIVersion
+	a.APIVersion = p.rootapi.APIVersion
 	a.SwaggerVersion = swagger.SwaggerVersion
 	a.ResourcePath = baseurl
 	a.Produces = []string{"application/json", "application/xml", "text/plain", "text/html"}
 	a.APIs = make([]swagger.API, 0)
 	a.Models = make(map[string]swagger.Model)
-	for _, p := range ce.Args {
-		x := p.(*ast.UnaryExpr).X.(*ast.CompositeLit).Type.(*ast.SelectorExpr)
-		if v, ok := importlist[fmt.Sprint(x.X)]; ok {
+	for _, arg := range ce.Args {
+		x := arg.(*ast.UnaryExpr).X.(*ast.CompositeLit).Type.(*ast.SelectorExpr)
+		if v, ok := p.importlist[fmt.Sprint(x.X)]; ok {
 			cname = v + x.Sel.Name
 		}
-		if apis, ok := controllerList[cname]; ok {
+		if apis, ok := p.controllerList[cname]; ok {
 			if len(a.APIs) > 0 {
 				a.APIs = append(a.APIs, apis...)
 			} else {
 				a.APIs = apis
 			}
 		}
-		if models, ok := modelsList[cname]; ok {
+		if models, ok := p.modelsList[cname]; ok {
 			for _, m := range models {
 				a.Models[m.ID] = m
 			}
 		}
 	}
-	apilist[baseurl] = a
+	p.apilist[baseurl] = a
 	return cname
 }
 
-func analisyscontrollerPkg(localName, pkgpath string) {
+func (p *docsParser) analisyscontrollerPkg(localName, pkgpath string) error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
 	pkgpath = strings.Trim(pkgpath, "\"")
-	if isSystemPackage(pkgpath) {
-		return
+	if system, err := isSystemPackage(pkgpath); err != nil || system {
+		return err
 	}
 	if localName != "" {
-		importlist[localName] = pkgpath
+		p.importlist[localName] = pkgpath
 	} else {
 		pps := strings.Split(pkgpath, "/")
-		importlist[pps[len(pps) - 1]] = pkgpath
+		p.importlist[pps[len(pps) - 1]] = pkgpath
 	}
 	if pkgpath == "github.com/qasico/beego" {
-		return
+		return nil
 	}
 	gopath := os.Getenv("GOPATH")
 	if gopath == "" {
-		panic("please set gopath")
+		return errors.New("please set gopath")
 	}
 	pkgRealpath := ""
 
@@ -226,22 +256,15 @@ func analisyscontrollerPkg(localName, pkgpath string) {
 		}
 	}
 	if pkgRealpath != "" {
-		if _, ok := pkgCache[pkgpath]; ok {
-			return
+		if _, ok := p.pkgCache[pkgpath]; ok {
+			return nil
 		}
 	} else {
-		helper.ColorLog("[ERRO] the %s pkg not exist in gopath\n", pkgpath)
-		os.Exit(1)
+		return fmt.Errorf("the %s pkg not exist in gopath", pkgpath)
 	}
-	fileSet := token.NewFileSet()
-	astPkgs, err := parser.ParseDir(fileSet, pkgRealpath, func(info os.FileInfo) bool {
-		name := info.Name()
-		return !info.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".go")
-	}, parser.ParseComments)
-
+	astPkgs, err := p.cache.parseDir(pkgRealpath)
 	if err != nil {
-		helper.ColorLog("[ERRO] the %s pkg parser.ParseDir error\n", pkgpath)
-		os.Exit(1)
+		return fmt.Errorf("the %s pkg parser.ParseDir error: %s", pkgpath, err)
 	}
 	for _, pkg := range astPkgs {
 		for _, fl := range pkg.Files {
@@ -250,7 +273,9 @@ func analisyscontrollerPkg(localName, pkgpath string) {
 				case *ast.FuncDecl:
 					if specDecl.Recv != nil && len(specDecl.Recv.List) > 0 {
 						if t, ok := specDecl.Recv.List[0].Type.(*ast.StarExpr); ok {
-							parserComments(specDecl.Doc, specDecl.Name.String(), fmt.Sprint(t.X), pkgpath)
+							if err := p.parserComments(specDecl.Doc, specDecl.Name.String(), fmt.Sprint(t.X), pkgpath); err != nil {
+								return err
+							}
 						}
 					}
 				case *ast.GenDecl:
@@ -259,7 +284,7 @@ func analisyscontrollerPkg(localName, pkgpath string) {
 							switch tp := s.(*ast.TypeSpec).Type.(type) {
 							case *ast.StructType:
 								_ = tp.Struct
-								controllerComments[pkgpath + s.(*ast.TypeSpec).Name.String()] = specDecl.Doc.Text()
+								p.controllerComments[pkgpath + s.(*ast.TypeSpec).Name.String()] = specDecl.Doc.Text()
 							}
 						}
 					}
@@ -267,29 +292,30 @@ func analisyscontrollerPkg(localName, pkgpath string) {
 			}
 		}
 	}
+	return nil
 }
 
-func isSystemPackage(pkgpath string) bool {
+func isSystemPackage(pkgpath string) (bool, error) {
 	goroot := runtime.GOROOT()
 	if goroot == "" {
-		panic("goroot is empty, do you install Go right?")
+		return false, errors.New("goroot is empty, do you install Go right?")
 	}
 	wg, _ := filepath.EvalSymlinks(filepath.Join(goroot, "src", "pkg", pkgpath))
 	if utils.FileExists(wg) {
-		return true
+		return true, nil
 	}
 
 	//TODO(zh):support go1.4
 	wg, _ = filepath.EvalSymlinks(filepath.Join(goroot, "src", pkgpath))
 	if utils.FileExists(wg) {
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
 // parse the func comments
-func parserComments(comments *ast.CommentGroup, funcName, controllerName, pkgpath string) error {
+func (p *docsParser) parserComments(comments *ast.CommentGroup, funcName, controllerName, pkgpath string) error {
 	innerapi := swagger.API{}
 	opts := swagger.Operation{}
 	if comments != nil && comments.List != nil {
@@ -346,36 +372,41 @@ func parserComments(comments *ast.CommentGroup, funcName, controllerName, pkgpat
 				rs.Message = st[2]
 				if st[1] == "{object}" {
 					if st[2] == "" {
-						panic(controllerName + " " + funcName + " has no object")
+						return errors.New(controllerName + " " + funcName + " has no object")
+					}
+					m, err := p.addModel(st[2], pkgpath, controllerName)
+					if err != nil {
+						return err
 					}
-					cmpath, m, mod, realTypes := getModel(st[2])
 					//ll := strings.Split(st[2], ".")
 					//opts.Type = ll[len(ll)-1]
 					rs.ResponseModel = m
-					if _, ok := modelsList[pkgpath + controllerName]; !ok {
-						modelsList[pkgpath + controllerName] = make(map[string]swagger.Model, 0)
-					}
-					modelsList[pkgpath + controllerName][st[2]] = mod
-					appendModels(cmpath, pkgpath, controllerName, realTypes)
 				}
 
 				rs.Code, _ = strconv.Atoi(st[0])
 				opts.ResponseMessages = append(opts.ResponseMessages, rs)
 			} else if strings.HasPrefix(t, "@Param") {
 				para := swagger.Parameter{}
-				p := getparams(strings.TrimSpace(t[len("@Param "):]))
-				if len(p) < 4 {
-					panic(controllerName + "_" + funcName + "'s comments @Param at least should has 4 params")
+				ps := getparams(strings.TrimSpace(t[len("@Param "):]))
+				if len(ps) < 4 {
+					return errors.New(controllerName + "_" + funcName + "'s comments @Param at least should has 4 params")
 				}
-				para.Name = p[0]
-				para.ParamType = p[1]
-				pp := strings.Split(p[2], ".")
+				para.Name = ps[0]
+				para.ParamType = ps[1]
+				pp := strings.Split(ps[2], ".")
 				para.DataType = pp[len(pp) - 1]
-				if len(p) > 4 {
-					para.Required, _ = strconv.ParseBool(p[3])
-					para.Description = p[4]
+				// body params referencing a struct, e.g. models.CreateUserInput,
+				// need its model declared as well
+				if para.ParamType == "body" && len(pp) > 1 {
+					if _, err := p.addModel(ps[2], pkgpath, controllerName); err != nil {
+						return err
+					}
+				}
+				if len(ps) > 4 {
+					para.Required, _ = strconv.ParseBool(ps[3])
+					para.Description = ps[4]
 				} else {
-					para.Description = p[3]
+					para.Description = ps[3]
 				}
 				opts.Parameters = append(opts.Parameters, para)
 			} else if strings.HasPrefix(t, "@Failure") {
@@ -422,16 +453,33 @@ func parserComments(comments *ast.CommentGroup, funcName, controllerName, pkgpat
 	}
 	innerapi.Operations = append(innerapi.Operations, opts)
 	if innerapi.Path != "" {
-		if _, ok := controllerList[pkgpath + controllerName]; ok {
-			controllerList[pkgpath + controllerName] = append(controllerList[pkgpath + controllerName], innerapi)
+		if _, ok := p.controllerList[pkgpath + controllerName]; ok {
+			p.controllerList[pkgpath + controllerName] = append(p.controllerList[pkgpath + controllerName], innerapi)
 		} else {
-			controllerList[pkgpath + controllerName] = make([]swagger.API, 1)
-			controllerList[pkgpath + controllerName][0] = innerapi
+			p.controllerList[pkgpath + controllerName] = make([]swagger.API, 1)
+			p.controllerList[pkgpath + controllerName][0] = innerapi
 		}
 	}
 	return nil
 }
 
+// addModel declares the model str, e.g. models.User, and the models it
+// references on the controller and returns the model name.
+func (p *docsParser) addModel(str, pkgpath, controllerName string) (string, error) {
+	cmpath, m, mod, realTypes, err := p.getModel(str)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := p.modelsList[pkgpath + controllerName]; !ok {
+		p.modelsList[pkgpath + controllerName] = make(map[string]swagger.Model, 0)
+	}
+	p.modelsList[pkgpath + controllerName][str] = mod
+	if err := p.appendModels(cmpath, pkgpath, controllerName, realTypes); err != nil {
+		return "", err
+	}
+	return m, nil
+}
+
 // analisys params return []string
 // @Param	query		form	 string	true		"The email for login"
 // [query form string true "The email for login"]
@@ -463,21 +511,15 @@ func getparams(str string) []string {
 	return r
 }
 
-func getModel(str string) (pkgpath, objectname string, m swagger.Model, realTypes []string) {
+func (p *docsParser) getModel(str string) (pkgpath, objectname string, m swagger.Model, realTypes []string, err error) {
 	strs := strings.Split(str, ".")
 	objectname = strs[len(strs) - 1]
 	pkgpath = strings.Join(strs[:len(strs) - 1], "/")
-	curpath, _ := os.Getwd()
-	pkgRealpath := path.Join(curpath, pkgpath)
-	fileSet := token.NewFileSet()
-	astPkgs, err := parser.ParseDir(fileSet, pkgRealpath, func(info os.FileInfo) bool {
-		name := info.Name()
-		return !info.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".go")
-	}, parser.ParseComments)
-
+	pkgRealpath := path.Join(p.appPath, pkgpath)
+	astPkgs, err := p.cache.parseDir(pkgRealpath)
 	if err != nil {
-		helper.ColorLog("[ERRO] the model %s parser.ParseDir error\n", str)
-		os.Exit(1)
+		err = fmt.Errorf("the model %s parser.ParseDir error: %s", str, err)
+		return
 	}
 
 	for _, pkg := range astPkgs {
@@ -489,8 +531,8 @@ func getModel(str string) (pkgpath, objectname string, m swagger.Model, realType
 					}
 					ts, ok := d.Decl.(*ast.TypeSpec)
 					if !ok {
-						helper.ColorLog("Unknown type without TypeSec: %v", d)
-						os.Exit(1)
+						err = fmt.Errorf("unknown type without TypeSec: %v", d)
+						return
 					}
 					st, ok := ts.Type.(*ast.StructType)
 					if !ok {
@@ -571,8 +613,7 @@ func getModel(str string) (pkgpath, objectname string, m swagger.Model, realType
 		}
 	}
 	if m.ID == "" {
-		helper.ColorLog("can't find the object: %v", str)
-		os.Exit(1)
+		err = fmt.Errorf("can't find the object: %v", str)
 	}
 	return
 }
@@ -630,23 +671,29 @@ func grepJsonTag(tag string) string {
 }
 
 // append models
-func appendModels(cmpath, pkgpath, controllerName string, realTypes []string) {
-	var p string
+func (p *docsParser) appendModels(cmpath, pkgpath, controllerName string, realTypes []string) error {
+	var prefix string
 	if cmpath != "" {
-		p = strings.Join(strings.Split(cmpath, "/"), ".") + "."
+		prefix = strings.Join(strings.Split(cmpath, "/"), ".") + "."
 	} else {
-		p = ""
+		prefix = ""
 	}
 	for _, realType := range realTypes {
 		if realType != "" && !isBasicType(strings.TrimLeft(realType, "[]")) &&
 		!strings.HasPrefix(realType, "map") && !strings.HasPrefix(realType, "&") {
-			if _, ok := modelsList[pkgpath + controllerName][p + realType]; ok {
+			if _, ok := p.modelsList[pkgpath + controllerName][prefix + realType]; ok {
 				continue
 			}
 			//fmt.Printf(pkgpath + ":" + controllerName + ":" + cmpath + ":" + realType + "\n")
-			_, _, mod, newRealTypes := getModel(p + realType)
-			modelsList[pkgpath + controllerName][p + realType] = mod
-			appendModels(cmpath, pkgpath, controllerName, newRealTypes)
+			_, _, mod, newRealTypes, err := p.getModel(prefix + realType)
+			if err != nil {
+				return err
+			}
+			p.modelsList[pkgpath + controllerName][prefix + realType] = mod
+			if err := p.appendModels(cmpath, pkgpath, controllerName, newRealTypes); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"sync"
+	"go/ast"
+	"strings"
+	"go/token"
+	"io/ioutil"
+	"go/parser"
+	"crypto/sha1"
+	"path/filepath"
+)
+
+// DocsCache keeps the parsed sources of the router, controllers and models
+// between Docs runs, so that only the files changed since are parsed again.
+type DocsCache struct {
+	mu    sync.Mutex
+	files map[string]*cachedFile
+}
+
+// cachedFile is a parsed file along with its own file set, which a session
+// wide one would keep growing with each parse.
+type cachedFile struct {
+	sum  [sha1.Size]byte
+	fset *token.FileSet
+	file *ast.File
+}
+
+// NewDocsCache returns an empty cache, to be passed in DocsOptions.
+func NewDocsCache() *DocsCache {
+	return &DocsCache{
+		files: make(map[string]*cachedFile),
+	}
+}
+
+// parseFile returns the syntax tree of the file, parsing it only when its
+// content changed since the last call.
+func (c *DocsCache) parseFile(name string) (*ast.File, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cf, ok := c.files[name]; ok && cf.sum == sum {
+		return cf.file, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, data, parser.ParseComments)
+	if err != nil {
+		delete(c.files, name)
+		return nil, err
+	}
+	c.files[name] = &cachedFile{sum: sum, fset: fset, file: f}
+	return f, nil
+}
+
+// parseDir returns the packages of the .go files of dir like parser.ParseDir,
+// using parseFile for each of them.
+func (c *DocsCache) parseDir(dir string) (map[string]*ast.Package, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := make(map[string]*ast.Package)
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		fpath := filepath.Join(dir, name)
+		f, err := c.parseFile(fpath)
+		if err != nil {
+			return nil, err
+		}
+		seen[fpath] = true
+		pkg, ok := pkgs[f.Name.Name]
+		if !ok {
+			pkg = &ast.Package{Name: f.Name.Name, Files: make(map[string]*ast.File)}
+			pkgs[f.Name.Name] = pkg
+		}
+		pkg.Files[fpath] = f
+	}
+
+	// forget the files removed from dir
+	c.mu.Lock()
+	for fpath := range c.files {
+		if filepath.Dir(fpath) == dir && !seen[fpath] {
+			delete(c.files, fpath)
+		}
+	}
+	c.mu.Unlock()
+	return pkgs, nil
+}
@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"os"
+	"fmt"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestDocsCacheReparsesChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docscache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "a.go")
+	write := func(src string) {
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := NewDocsCache()
+	write("package a\n")
+	first, err := cache.parseFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := cache.parseFile(name); f != first {
+		t.Errorf("unchanged file parsed again")
+	}
+
+	var src string
+	for i := 0; i < 100; i++ {
+		src = fmt.Sprintf("package a\n\nvar v%d int\n", i)
+		write(src)
+		if _, err := cache.parseFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cf := cache.files[name]
+	if cf.file == first {
+		t.Errorf("changed file not parsed again")
+	}
+	// the file set only holds the last parse
+	if base := cf.fset.Base(); base > len(src) + 2 {
+		t.Errorf("file set base = %d after 100 parses of %d bytes", base, len(src))
+	}
+}
@@ -0,0 +1,164 @@
+package generator
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// TableFilter selects the tables to introspect. Patterns are either globs
+// such as `log_*` or regular expressions wrapped in slashes such as `/^tmp_\d+$/`.
+// A table is selected when it matches any include pattern (or no include
+// pattern is given) and none of the exclude patterns.
+type TableFilter struct {
+	Include []string
+	Exclude []string
+
+	// include and exclude are the compiled patterns, see Validate.
+	include  []tablePattern
+	exclude  []tablePattern
+	compiled bool
+}
+
+// NewTableFilter builds a filter from comma separated include and exclude
+// lists, commas inside /regexp/ patterns not separating them.
+func NewTableFilter(include, exclude string) *TableFilter {
+	return &TableFilter{
+		Include: SplitPatterns(include),
+		Exclude: SplitPatterns(exclude),
+	}
+}
+
+// Validate compiles the patterns and reports the first malformed one. Match
+// compiles them on first use otherwise, so Validate has to be called again
+// after changing Include or Exclude.
+func (f *TableFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	var err, exErr error
+	f.include, err = compilePatterns(f.Include)
+	f.exclude, exErr = compilePatterns(f.Exclude)
+	f.compiled = true
+	if err == nil {
+		err = exErr
+	}
+	return err
+}
+
+// Match returns true if the table name passes the filter.
+func (f *TableFilter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+	if !f.compiled {
+		f.Validate()
+	}
+	if len(f.Include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+// Apply returns the table names passing the filter, keeping their order.
+func (f *TableFilter) Apply(names []string) (selected []string) {
+	for _, name := range names {
+		if f.Match(name) {
+			selected = append(selected, name)
+		}
+	}
+	return
+}
+
+// tablePattern is a compiled glob or /regexp/ pattern.
+type tablePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func (p tablePattern) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+// compilePatterns compiles the valid patterns and returns the error of the
+// first malformed one.
+func compilePatterns(patterns []string) (compiled []tablePattern, err error) {
+	for _, p := range patterns {
+		c, perr := compilePattern(p)
+		if perr != nil {
+			if err == nil {
+				err = perr
+			}
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, err
+}
+
+func compilePattern(pattern string) (tablePattern, error) {
+	if isRegexpPattern(pattern) {
+		re, err := regexp.Compile(pattern[1:len(pattern) - 1])
+		if err != nil {
+			return tablePattern{}, fmt.Errorf("invalid pattern %s: %s", pattern, err)
+		}
+		return tablePattern{re: re}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return tablePattern{}, fmt.Errorf("invalid pattern %s: %s", pattern, err)
+	}
+	return tablePattern{glob: pattern}, nil
+}
+
+func isRegexpPattern(pattern string) bool {
+	return len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+func matchAny(patterns []tablePattern, name string) bool {
+	for _, p := range patterns {
+		if p.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitPatterns splits a comma separated list of table or column patterns.
+// A pattern starting with / runs up to the / followed by a comma or the end
+// of the list, so that regular expressions such as /^t_\d{1,3}$/ may hold
+// commas.
+func SplitPatterns(list string) (patterns []string) {
+	for list != "" {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			break
+		}
+		end := -1
+		if list[0] == '/' {
+			for i := 1; i < len(list); i++ {
+				if list[i] != '/' {
+					continue
+				}
+				if rest := strings.TrimLeft(list[i + 1:], " \t"); rest == "" || rest[0] == ',' {
+					end = i + 1
+					break
+				}
+			}
+		}
+		if end < 0 {
+			if end = strings.Index(list, ","); end < 0 {
+				end = len(list)
+			}
+		}
+		if p := strings.TrimSpace(list[:end]); p != "" {
+			patterns = append(patterns, p)
+		}
+		list = list[end:]
+	}
+	return
+}
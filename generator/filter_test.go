@@ -0,0 +1,80 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPatterns(t *testing.T) {
+	cases := []struct {
+		list     string
+		patterns []string
+	}{
+		{"", nil},
+		{"users, orders ,,logs", []string{"users", "orders", "logs"}},
+		{`/^t_\d{1,3}$/`, []string{`/^t_\d{1,3}$/`}},
+		{`log_*,/^t_\d{1,3}$/ , /a,b/,users`, []string{"log_*", `/^t_\d{1,3}$/`, "/a,b/", "users"}},
+		{`/^a/b$/,c`, []string{`/^a/b$/`, "c"}},
+		// not a regexp as it does not end with /
+		{"/tmp,users", []string{"/tmp", "users"}},
+	}
+	for _, c := range cases {
+		if got := SplitPatterns(c.list); !reflect.DeepEqual(got, c.patterns) {
+			t.Errorf("SplitPatterns(%q) = %q, want %q", c.list, got, c.patterns)
+		}
+	}
+}
+
+func TestTableFilter(t *testing.T) {
+	cases := []struct {
+		include, exclude string
+		name             string
+		match            bool
+	}{
+		{"", "", "users", true},
+		{"user*", "", "users", true},
+		{"user*", "", "orders", false},
+		{"user?", "", "users", true},
+		{"user?", "", "user_roles", false},
+		{`/^t_\d{1,3}$/`, "", "t_12", true},
+		{`/^t_\d{1,3}$/`, "", "t_1234", false},
+		{"orders,/^user/", "", "user_roles", true},
+		{"", "log_*,migrations", "log_2020", false},
+		{"", "log_*,migrations", "logs", true},
+		{"", `/_(tmp|bak)$/`, "users_bak", false},
+		// exclude wins when both match
+		{"user*", "users_*", "users_bak", false},
+		{"user*", "users_*", "users", true},
+		{`/^user/`, `/bak$/`, "users_bak", false},
+	}
+	for _, c := range cases {
+		f := NewTableFilter(c.include, c.exclude)
+		if err := f.Validate(); err != nil {
+			t.Errorf("%q %q: %s", c.include, c.exclude, err)
+			continue
+		}
+		if got := f.Match(c.name); got != c.match {
+			t.Errorf("include %q exclude %q: Match(%q) = %t, want %t", c.include, c.exclude, c.name, got, c.match)
+		}
+	}
+}
+
+func TestTableFilterValidate(t *testing.T) {
+	for _, f := range []*TableFilter{
+		NewTableFilter(`/^t_(\d+$/`, ""),
+		NewTableFilter("", "log_[a-"),
+	} {
+		if err := f.Validate(); err == nil {
+			t.Errorf("%q %q: malformed pattern accepted", f.Include, f.Exclude)
+		}
+	}
+	var f *TableFilter
+	if err := f.Validate(); err != nil || !f.Match("users") {
+		t.Error("a nil filter does not select all tables")
+	}
+	// Match compiles the patterns when Validate was not called
+	f = &TableFilter{Exclude: []string{"log_*"}}
+	if f.Match("log_1") || !f.Match("users") {
+		t.Error("filter without Validate does not match")
+	}
+}
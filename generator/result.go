@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"os"
+	"fmt"
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// File is a generated source file, Path being relative to the application root.
+type File struct {
+	// Kind is one of model, controller, router or docs.
+	Kind    string
+	Path    string
+	Content []byte
+}
+
+// Result holds the files produced by a generator run.
+type Result struct {
+	Files    []*File
+	Tables   []*Table
+	// Warnings are non fatal issues, such as a file that could not be gofmt'ed.
+	Warnings []string
+}
+
+// add formats content as Go source and appends it to the result, keeping the
+// unformatted source with a warning if it does not parse.
+func (r *Result) add(kind, path, content string) {
+	src, err := format.Source([]byte(content))
+	if err != nil {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("gofmt %s: %s", path, err))
+		src = []byte(content)
+	}
+	r.Files = append(r.Files, &File{Kind: kind, Path: path, Content: src})
+}
+
+// Write stores the files under root and returns the ones actually written.
+// Files whose content is unchanged are left untouched, other existing files
+// are only replaced when overwrite returns true for their path; a nil
+// overwrite replaces everything.
+func (r *Result) Write(root string, overwrite func(path string) bool) (written []*File, err error) {
+	for _, f := range r.Files {
+		fpath := filepath.Join(root, filepath.FromSlash(f.Path))
+		if old, err := ioutil.ReadFile(fpath); err == nil && bytes.Equal(old, f.Content) {
+			continue
+		}
+		if _, err := os.Stat(fpath); err == nil && overwrite != nil && !overwrite(fpath) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			return written, err
+		}
+		if err := ioutil.WriteFile(fpath, f.Content, 0666); err != nil {
+			return written, fmt.Errorf("could not write %s file to %s: %s", f.Kind, fpath, err)
+		}
+		written = append(written, f)
+	}
+	return written, nil
+}
@@ -0,0 +1,143 @@
+package helper
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"bufio"
+	"strings"
+)
+
+// ParseEnv parses the KEY=VALUE lines of a .env file, blank lines, lines
+// starting with # and a leading "export " are ignored. Values may be single
+// quoted (taken literally), double quoted (supporting \n, \t, \", \$ and \\
+// escapes) or bare, in which case a trailing " # comment" is dropped.
+// ${VAR} and $VAR are expanded in double quoted and bare values, looking up
+// the keys parsed so far first and then lookup.
+func ParseEnv(r io.Reader, lookup func(string) (string, bool)) (keys []string, values map[string]string, err error) {
+	values = make(map[string]string)
+	expand := func(key string) string {
+		if v, ok := values[key]; ok {
+			return v
+		}
+		if lookup != nil {
+			v, _ := lookup(key)
+			return v
+		}
+		return ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		value, err := parseEnvValue(strings.TrimSpace(line[i + 1:]), expand)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+	return keys, values, scanner.Err()
+}
+
+func parseEnvValue(raw string, expand func(string) string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '\'':
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+		return raw[1:end + 1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '\\' && i + 1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '$':
+					// keep escaped dollars away from os.Expand
+					b.WriteString("$$")
+				default:
+					b.WriteByte(raw[i])
+				}
+			case c == '"':
+				return expandEnv(b.String(), expand), nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quoted value")
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return expandEnv(raw, expand), nil
+}
+
+// expandEnv replaces ${VAR} and $VAR by their values, $$ being a literal $.
+func expandEnv(s string, expand func(string) string) string {
+	return os.Expand(s, func(key string) string {
+		if key == "$" {
+			return "$"
+		}
+		return expand(key)
+	})
+}
+
+// LoadEnvFiles parses the given .env files in order, values of later files
+// overriding earlier ones, and returns them as KEY=VALUE pairs. Missing files
+// are skipped.
+func LoadEnvFiles(names ...string) (env []string, err error) {
+	var keys []string
+	values := make(map[string]string)
+	for _, name := range names {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		fkeys, fvalues, err := ParseEnv(f, func(key string) (string, bool) {
+			if v, ok := values[key]; ok {
+				return v, true
+			}
+			return os.LookupEnv(key)
+		})
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		for _, key := range fkeys {
+			if _, ok := values[key]; !ok {
+				keys = append(keys, key)
+			}
+			values[key] = fvalues[key]
+		}
+	}
+	for _, key := range keys {
+		env = append(env, key + "=" + values[key])
+	}
+	return env, nil
+}
@@ -0,0 +1,68 @@
+package helper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		if key == "HOME" {
+			return "/home/fire", true
+		}
+		return "", false
+	}
+	cases := []struct {
+		name   string
+		input  string
+		keys   []string
+		values map[string]string
+	}{
+		{"bare", "A=1", []string{"A"}, map[string]string{"A": "1"}},
+		{"spaces", "  A = 1  ", []string{"A"}, map[string]string{"A": "1"}},
+		{"empty value", "A=", []string{"A"}, map[string]string{"A": ""}},
+		{"export", "export A=1", []string{"A"}, map[string]string{"A": "1"}},
+		{"comments and blank lines", "# comment\n\n  # indented\nA=1\n", []string{"A"}, map[string]string{"A": "1"}},
+		{"inline comment", "A=foo # comment", []string{"A"}, map[string]string{"A": "foo"}},
+		{"hash without space", "A=foo#bar", []string{"A"}, map[string]string{"A": "foo#bar"}},
+		{"single quoted", `A='a # b $HOME \n'`, []string{"A"}, map[string]string{"A": `a # b $HOME \n`}},
+		{"double quoted hash", `A="a#b" # comment`, []string{"A"}, map[string]string{"A": "a#b"}},
+		{"double quoted escapes", `A="say \"hi\"\tx\n\\"`, []string{"A"}, map[string]string{"A": "say \"hi\"\tx\n\\"}},
+		{"escaped dollar", `A="\$HOME"`, []string{"A"}, map[string]string{"A": "$HOME"}},
+		{"expansion", "A=1\nB=${A}-$HOME\nC=\"${UNSET}x\"", []string{"A", "B", "C"},
+			map[string]string{"A": "1", "B": "1-/home/fire", "C": "x"}},
+		{"redefinition", "A=1\nB=2\nA=3", []string{"A", "B"}, map[string]string{"A": "3", "B": "2"}},
+		{"crlf", "A=1\r\nB=\"2\"\r\n", []string{"A", "B"}, map[string]string{"A": "1", "B": "2"}},
+	}
+	for _, c := range cases {
+		keys, values, err := ParseEnv(strings.NewReader(c.input), lookup)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(keys, c.keys) || !reflect.DeepEqual(values, c.values) {
+			t.Errorf("%s: got %q %q, want %q %q", c.name, keys, values, c.keys, c.values)
+		}
+	}
+}
+
+func TestParseEnvMalformed(t *testing.T) {
+	cases := []struct {
+		input string
+		err   string
+	}{
+		{"NOEQUALS", "line 1: expected KEY=VALUE"},
+		{"A=1\n=x", "line 2: expected KEY=VALUE"},
+		{"export", "line 1: expected KEY=VALUE"},
+		{"A='abc", "line 1: unterminated single quoted value"},
+		{"# c\nA=\"abc", "line 2: unterminated double quoted value"},
+		{`A="abc\"`, "line 1: unterminated double quoted value"},
+	}
+	for _, c := range cases {
+		_, _, err := ParseEnv(strings.NewReader(c.input), nil)
+		if err == nil || err.Error() != c.err {
+			t.Errorf("%q: got error %v, want %s", c.input, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package helper
+
+import (
+	"os"
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// Ignore matches paths against gitignore style patterns, later patterns
+// taking precedence and "!" re-including what earlier ones excluded.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewIgnore returns an Ignore of the given patterns.
+func NewIgnore(patterns []string) *Ignore {
+	ig := &Ignore{}
+	for _, p := range patterns {
+		ig.Add(p)
+	}
+	return ig
+}
+
+// Add appends a pattern, blank lines and comments are ignored.
+func (ig *Ignore) Add(pattern string) {
+	p := strings.TrimSpace(pattern)
+	if p == "" || p[0] == '#' {
+		return
+	}
+	rule := ignoreRule{}
+	if p[0] == '!' {
+		rule.negate = true
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		rule.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	// patterns with a slash are relative to the root, others match at any depth
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return
+	}
+
+	expr := "(^|.*/)"
+	if anchored {
+		expr = "^"
+	}
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case strings.HasPrefix(p[i:], "**/"):
+			expr += "(.*/)?"
+			i += 2
+		case strings.HasPrefix(p[i:], "/**") && i + 3 == len(p):
+			// everything inside, not the directory itself
+			expr += "/.*"
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			expr += ".*"
+			i++
+		case c == '*':
+			expr += "[^/]*"
+		case c == '?':
+			expr += "[^/]"
+		case c == '[':
+			if j := strings.IndexByte(p[i:], ']'); j > 0 {
+				expr += strings.Replace(p[i:i + j + 1], "[!", "[^", 1)
+				i += j
+			} else {
+				expr += regexp.QuoteMeta("[")
+			}
+		case c == '\\' && i + 1 < len(p):
+			i++
+			expr += regexp.QuoteMeta(p[i:i + 1])
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+	re, err := regexp.Compile(expr + "$")
+	if err != nil {
+		return
+	}
+	rule.re = re
+	ig.rules = append(ig.rules, rule)
+}
+
+// AddFile appends the patterns of a .gitignore like file, a missing file
+// is not an error.
+func (ig *Ignore) AddFile(name string) error {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		ig.Add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Match returns true if the slash separated path, relative to the root of
+// the patterns, is ignored. Like git, nothing inside an ignored directory
+// can be included again.
+func (ig *Ignore) Match(path string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		if ig.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return ig.match(strings.Join(parts, "/"), isDir)
+}
+
+func (ig *Ignore) match(path string, isDir bool) (ignored bool) {
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(path) {
+			ignored = !rule.negate
+		}
+	}
+	return
+}
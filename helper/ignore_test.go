@@ -0,0 +1,65 @@
+package helper
+
+import (
+	"testing"
+)
+
+func TestIgnore(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		ignored  bool
+	}{
+		// unanchored patterns match at any depth
+		{[]string{"*.swp"}, "main.go.swp", false, true},
+		{[]string{"*.swp"}, "models/.user.go.swp", false, true},
+		{[]string{"*.swp"}, "main.go", false, false},
+		{[]string{"*.log"}, "logs/a/b.log", false, true},
+		// a trailing slash only matches directories, and what they contain
+		{[]string{"tmp/"}, "tmp", true, true},
+		{[]string{"tmp/"}, "tmp", false, false},
+		{[]string{"tmp/"}, "tmp/main.go", false, true},
+		{[]string{"tmp/"}, "models/tmp/user.go", false, true},
+		// a slash anchors the pattern at the root
+		{[]string{"/build"}, "build", true, true},
+		{[]string{"/build"}, "cmd/build", true, false},
+		{[]string{"conf/*.conf"}, "conf/app.conf", false, true},
+		{[]string{"conf/*.conf"}, "sub/conf/app.conf", false, false},
+		{[]string{"conf/*.conf"}, "conf/dev/app.conf", false, false},
+		// ** matches any number of directories
+		{[]string{"**/gen"}, "gen", true, true},
+		{[]string{"**/gen"}, "a/b/gen", true, true},
+		{[]string{"assets/**"}, "assets/js/app.js", false, true},
+		{[]string{"assets/**"}, "assets", true, false},
+		{[]string{"a/**/z.go"}, "a/z.go", false, true},
+		{[]string{"a/**/z.go"}, "a/b/c/z.go", false, true},
+		{[]string{"a/**/z.go"}, "b/a/z.go", false, false},
+		// later patterns win, ! includes back
+		{[]string{"*.go", "!main.go"}, "main.go", false, false},
+		{[]string{"*.go", "!main.go"}, "user.go", false, true},
+		{[]string{"!main.go", "*.go"}, "main.go", false, true},
+		{[]string{"tmp/", "!tmp/"}, "tmp/x.go", false, false},
+		// nothing inside an ignored directory can be included back
+		{[]string{"vendor/", "!vendor/keep.go"}, "vendor/keep.go", false, true},
+		// comments, blank lines and escapes
+		{[]string{"# main.go", "", "\\#notes"}, "main.go", false, false},
+		{[]string{"# main.go", "", "\\#notes"}, "#notes", false, true},
+		{[]string{"file[0-9].go"}, "file3.go", false, true},
+		{[]string{"file[!0-9].go"}, "file3.go", false, false},
+		{[]string{"?.go"}, "a.go", false, true},
+		{[]string{"?.go"}, "ab.go", false, false},
+	}
+	for _, c := range cases {
+		if got := NewIgnore(c.patterns).Match(c.path, c.isDir); got != c.ignored {
+			t.Errorf("%q: Match(%q, %t) = %t, want %t", c.patterns, c.path, c.isDir, got, c.ignored)
+		}
+	}
+}
+
+func TestIgnoreNil(t *testing.T) {
+	var ig *Ignore
+	if ig.Match("main.go", false) {
+		t.Error("a nil Ignore matched")
+	}
+}
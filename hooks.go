@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"time"
+	"context"
+	"runtime"
+	"strings"
+	"os/exec"
+
+	"github.com/qasico/fire/helper"
+)
+
+// defaultHookTimeout applies to hooks without timeout.
+const defaultHookTimeout = 60
+
+// Stages of the hooks of fire.json.
+const (
+	hookPreBuild  = "pre_build"
+	hookPostBuild = "post_build"
+	hookPreStart  = "pre_start"
+)
+
+// runHooks runs the hooks of a stage in order. A failing hook stops the
+// stage with an error unless its on_error is "continue". The hooks get the
+// stage in FIRE_HOOK, the app name in FIRE_APP and the changed files,
+// relative to the app and separated by spaces, in FIRE_CHANGED.
+func runHooks(ctx context.Context, stage string, hooks []confHook, changed []string, stderr io.Writer) error {
+	env := append(os.Environ(),
+		"FIRE_HOOK=" + stage,
+		"FIRE_APP=" + appname,
+		"FIRE_CHANGED=" + strings.Join(changed, " "))
+	for _, h := range hooks {
+		timeout := time.Duration(h.Timeout) * time.Second
+		if h.Timeout <= 0 {
+			timeout = defaultHookTimeout * time.Second
+		}
+		hctx, cancel := context.WithTimeout(ctx, timeout)
+		c := shellCommand(hctx, h.Cmd)
+		c.Stdout = os.Stdout
+		c.Stderr = stderr
+		c.Env = env
+		helper.ColorLog("[INFO] Running %s hook: %s\n", stage, h.Cmd)
+		err := runShell(c)
+		if hctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			continue
+		}
+		if h.OnError == "continue" {
+			helper.ColorLog("[WARN] %s hook %s failed[ %s ]\n", stage, h.Cmd, err)
+			continue
+		}
+		return fmt.Errorf("%s hook %s failed: %s", stage, h.Cmd, err)
+	}
+	return nil
+}
+
+// shellCommand runs command through the shell of the system.
+func shellCommand(ctx context.Context, command string) (c *exec.Cmd) {
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		c = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	return c
+}
+
+// runShell runs c like c.Run. Children of the shell, e.g. those left behind
+// when a hook is killed, may keep its stderr open, so runShell only waits a
+// second for it after the shell exited.
+func runShell(c *exec.Cmd) error {
+	stderr := c.Stderr
+	if _, ok := stderr.(*os.File); ok || stderr == nil {
+		return c.Run()
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	c.Stderr = w
+	err = c.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(stderr, r)
+		close(copied)
+	}()
+	err = c.Wait()
+	select {
+	case <-copied:
+	case <-time.After(time.Second):
+		r.Close()
+		<-copied
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunHooksDoesNotWaitForChildren(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available")
+	}
+	cases := []struct {
+		hook   confHook
+		err    string
+		output string
+	}{
+		// the background sleep keeps the stderr of the shell open
+		{confHook{Cmd: "sleep 5 & echo started >&2"}, "", "started"},
+		{confHook{Cmd: "echo slow >&2; sleep 5", Timeout: 1}, "pre_start hook echo slow >&2; sleep 5 failed: timed out after 1s", "slow"},
+		{confHook{Cmd: "echo failed >&2; exit 3"}, "pre_start hook echo failed >&2; exit 3 failed: exit status 3", "failed"},
+	}
+	for _, c := range cases {
+		var output bytes.Buffer
+		start := time.Now()
+		err := runHooks(context.Background(), hookPreStart, []confHook{c.hook}, nil, &output)
+		if d := time.Since(start); d > 3 * time.Second {
+			t.Errorf("%s: returned after %s", c.hook.Cmd, d)
+		}
+		if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+			t.Errorf("%s: got error %v, want %q", c.hook.Cmd, err, c.err)
+		}
+		if !strings.Contains(output.String(), c.output) {
+			t.Errorf("%s: output %q lacks %q", c.hook.Cmd, output.String(), c.output)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"net/http"
+)
+
+// liveReloadAddr serves the live reload endpoints when fire run has no proxy.
+const liveReloadAddr = "127.0.0.1:35729"
+
+// liveReloadScript reloads the page when the events endpoint says so, from
+// the origin it is loaded from.
+const liveReloadScript = `(function() {
+	var origin = document.currentScript ? new URL(document.currentScript.src).origin : "";
+	var events = new EventSource(origin + "/__livereload");
+	events.onmessage = function(e) {
+		if (e.data === "reload") {
+			location.reload();
+		}
+	};
+})();
+`
+
+// liveReloadTag is injected into the HTML responses of the proxy.
+const liveReloadTag = `<script src="/__livereload.js"></script>`
+
+// liveReload is the server sent events hub of fire run -livereload, nil
+// without it.
+var liveReload *reloadHub
+
+// reloadHub tells the connected browser tabs to reload.
+type reloadHub struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func newReloadHub() *reloadHub {
+	return &reloadHub{clients: make(map[chan struct{}]bool)}
+}
+
+// reload notifies the connected tabs.
+func (h *reloadHub) reload() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ServeHTTP serves the script at /__livereload.js and the events at /__livereload.
+func (h *reloadHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.URL.Path == "/__livereload.js" {
+		w.Header().Set("Content-Type", "application/javascript")
+		fmt.Fprint(w, liveReloadScript)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	c := make(chan struct{}, 1)
+	h.mu.Lock()
+	h.clients[c] = true
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, c)
+		h.mu.Unlock()
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c:
+			fmt.Fprint(w, "data: reload\n\n")
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// isLiveReloadPath returns true for the paths served by reloadHub.
+func isLiveReloadPath(path string) bool {
+	return path == "/__livereload" || path == "/__livereload.js"
+}
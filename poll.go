@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+	"path/filepath"
+)
+
+// defaultPollInterval is used when fsnotify can not be set up.
+const defaultPollInterval = 500 * time.Millisecond
+
+// pollWatcher detects changes by listing the watched directories at every
+// interval, for file systems without working notifications such as Docker
+// bind mounts, NFS or Vagrant shared folders. It compares sizes and
+// modification times, the content hashes are compared by the caller.
+type pollWatcher struct {
+	interval time.Duration
+	events   chan watchEvent
+	errors   chan error
+
+	mu       sync.Mutex
+	// dirs holds the last snapshot of every watched directory.
+	dirs     map[string]map[string]fileStat
+}
+
+type fileStat struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func newPollWatcher(interval time.Duration) *pollWatcher {
+	w := &pollWatcher{
+		interval: interval,
+		events:   make(chan watchEvent, 64),
+		errors:   make(chan error),
+		dirs:     make(map[string]map[string]fileStat),
+	}
+	go w.poll()
+	return w
+}
+
+func (w *pollWatcher) Events() <-chan watchEvent {
+	return w.events
+}
+
+func (w *pollWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Watch takes the first snapshot of the directory.
+func (w *pollWatcher) Watch(path string) error {
+	snapshot, err := readSnapshot(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.dirs[path] = snapshot
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *pollWatcher) RemoveWatch(path string) error {
+	w.mu.Lock()
+	delete(w.dirs, path)
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *pollWatcher) poll() {
+	for range time.Tick(w.interval) {
+		w.mu.Lock()
+		dirs := make([]string, 0, len(w.dirs))
+		for dir := range w.dirs {
+			dirs = append(dirs, dir)
+		}
+		w.mu.Unlock()
+
+		for _, dir := range dirs {
+			// a removed directory is reported by its parent
+			snapshot, err := readSnapshot(dir)
+			if err != nil {
+				continue
+			}
+			w.mu.Lock()
+			old, ok := w.dirs[dir]
+			if ok {
+				w.dirs[dir] = snapshot
+			}
+			w.mu.Unlock()
+			if ok {
+				w.compare(dir, old, snapshot)
+			}
+		}
+	}
+}
+
+// compare sends the events turning the old snapshot of dir into the new one.
+func (w *pollWatcher) compare(dir string, old, snapshot map[string]fileStat) {
+	for name, st := range snapshot {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			w.events <- watchEvent{Name: filepath.Join(dir, name), Create: true}
+		case !st.isDir && (st.size != prev.size || !st.modTime.Equal(prev.modTime)):
+			w.events <- watchEvent{Name: filepath.Join(dir, name)}
+		}
+	}
+	for name := range old {
+		if _, ok := snapshot[name]; !ok {
+			w.events <- watchEvent{Name: filepath.Join(dir, name), Remove: true}
+		}
+	}
+}
+
+func readSnapshot(dir string) (map[string]fileStat, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]fileStat, len(infos))
+	for _, fi := range infos {
+		snapshot[fi.Name()] = fileStat{size: fi.Size(), modTime: fi.ModTime(), isDir: fi.IsDir()}
+	}
+	return snapshot, nil
+}
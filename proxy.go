@@ -0,0 +1,210 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+	"bytes"
+	"strconv"
+	"strings"
+	"net/url"
+	"net/http"
+	"io/ioutil"
+	"net/http/httputil"
+
+	"github.com/qasico/fire/helper"
+)
+
+// proxyHoldTimeout bounds how long a request waits for the app to be ready.
+const proxyHoldTimeout = 2 * time.Minute
+
+// devProxy is the reverse proxy of fire run -proxy, nil without it.
+var devProxy *appProxy
+
+// appProxy listens on a stable address and forwards requests to the app,
+// which listens on an internal port given through API_PORT. Requests made
+// while the app is rebuilt or restarted are held until it is ready.
+type appProxy struct {
+	port  string
+	proxy *httputil.ReverseProxy
+
+	mu    sync.Mutex
+	// ready is closed while the app accepts requests.
+	ready chan struct{}
+	// app is closed when the current app process exits, see Start.
+	app   chan struct{}
+	// failure is served instead of the app after a failed build or a crash.
+	failure *buildFailure
+}
+
+// startProxy listens on addr and returns the proxy, which holds requests
+// until the app is first ready.
+func startProxy(addr string) (*appProxy, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := freePort()
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	target := &url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", port)}
+	p := &appProxy{
+		port:  port,
+		proxy: httputil.NewSingleHostReverseProxy(target),
+		ready: make(chan struct{}),
+	}
+	p.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		helper.ColorLog("[WARN] Proxy %s %s[ %s ]\n", r.Method, r.URL, err)
+		http.Error(w, "fire: the app is not reachable: " + err.Error(), http.StatusBadGateway)
+	}
+	if liveReload != nil {
+		director := p.proxy.Director
+		p.proxy.Director = func(r *http.Request) {
+			director(r)
+			// compressed pages could not get the script injected
+			r.Header.Del("Accept-Encoding")
+		}
+		p.proxy.ModifyResponse = injectLiveReload
+	}
+	go http.Serve(l, p)
+	return p, nil
+}
+
+// injectLiveReload adds the live reload script to the HTML pages of the app.
+func injectLiveReload(res *http.Response) error {
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") || res.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	if i := bytes.LastIndex(body, []byte("</body>")); i >= 0 {
+		body = append(body[:i], append([]byte(liveReloadTag), body[i:]...)...)
+	} else {
+		body = append(body, liveReloadTag...)
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// freePort returns a local port nothing listens on.
+func freePort() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	return port, err
+}
+
+// hold makes incoming requests wait until release is called.
+func (p *appProxy) hold() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.ready:
+		p.ready = make(chan struct{})
+	default:
+	}
+}
+
+// release forwards the held and incoming requests to the app.
+func (p *appProxy) release() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.ready:
+	default:
+		close(p.ready)
+	}
+}
+
+// fail serves f to every request until it is called with nil.
+func (p *appProxy) fail(f *buildFailure) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.failure = f
+	p.mu.Unlock()
+}
+
+// clearCrash stops serving the crash of the previous app process, see
+// serveCrash.
+func (p *appProxy) clearCrash() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if p.failure != nil && p.failure.crash {
+		p.failure = nil
+	}
+	p.mu.Unlock()
+}
+
+// setApp holds the requests until the app process of done is ready.
+func (p *appProxy) setApp(done chan struct{}) {
+	if p == nil {
+		return
+	}
+	p.hold()
+	p.mu.Lock()
+	p.app = done
+	p.mu.Unlock()
+}
+
+// releaseApp calls release unless the app process of done has been replaced
+// meanwhile.
+func (p *appProxy) releaseApp(done chan struct{}) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	current := p.app == done
+	p.mu.Unlock()
+	if current {
+		p.release()
+	}
+}
+
+func (p *appProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if liveReload != nil && isLiveReloadPath(r.URL.Path) {
+		liveReload.ServeHTTP(w, r)
+		return
+	}
+
+	p.mu.Lock()
+	ready := p.ready
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+	case <-r.Context().Done():
+		return
+	case <-time.After(proxyHoldTimeout):
+		http.Error(w, "fire: the app is still not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	p.mu.Lock()
+	failure := p.failure
+	p.mu.Unlock()
+	if failure != nil {
+		failure.ServeHTTP(w, r)
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
@@ -16,21 +16,93 @@ package main
 
 import (
 	"os"
+	"time"
 	"runtime"
 	"strings"
+	"net/http"
 	"io/ioutil"
 	path "path/filepath"
 
 	"github.com/qasico/fire/helper"
+	"github.com/qasico/fire/generator"
 )
 
 var cmdRun = &Command{
-	UsageLine: "run [appname] [watchall] [-main=*.go] [-downdoc=true]  [-gendoc=true]",
+	UsageLine: "run [appname] [watchall] [-main=*.go] [-downdoc=true]  [-gendoc=true] [-env=staging] [-profile=dev] [-proxy=:3000] [-livereload] [-poll=500ms] [-restart=on-failure] [-test] [-debug] [-debugport=2345]",
 	Short:     "run the app and start a Web server for development",
 	Long: `
 Run command will supervise the file system of the beego project using inotify,
 it will recompile and restart the app after any modifications.
 
+The directories of the app holding .go files, watch_ext or watch.actions
+files are watched, along with the directories created while running.
+"watchall" or dir_structure.watch_all watch all of them instead, e.g. for a
+package created in a directory without such files. Hidden directories,
+vendor/, node_modules/, tmp/, docs/, swagger/, editor swap files and the
+paths excluded by watch.exclude of fire.json, .gitignore and .fireignore,
+which share the .gitignore syntax, are never watched. A "!tmp/" pattern
+watches back a directory excluded by default.
+Only changes of .go files, watch_ext and watch.actions trigger a build.
+
+watch.actions of fire.json maps extensions or globs to what their changes
+do, the longest matching pattern winning:
+    "watch": {"actions": {
+        "conf/*.conf": "restart",     restart without building
+        ".tpl": "notify",             only reload the browser tabs
+        "static/**": "none",          nothing
+        ".proto": "go generate ./..." run the command
+    }}
+
+The variables of the .env file of the app are passed to it on every start,
+-env=staging layers .env.staging on top of them and sets APP_ENV=staging.
+
+-profile=dev applies the dev profile of fire.json, overriding its envs,
+cmd_args and watch settings. The default is $FIRE_PROFILE.
+
+-proxy=:3000 listens on :3000 and forwards the requests to the app, which is
+started with API_PORT set to an internal port. Requests made while the app
+is rebuilt or restarted wait for it instead of failing.
+
+hooks of fire.json run commands before and after each build and before each
+start, with the changed files in $FIRE_CHANGED, e.g.
+    "hooks": {
+        "pre_build": [{"cmd": "go generate ./...", "timeout": 30}],
+        "post_build": [{"cmd": "go vet ./...", "on_error": "continue"}],
+        "pre_start": [{"cmd": "./migrate up"}]
+    }
+A failing hook stops the build or start unless its on_error is "continue".
+
+-gendoc=true regenerates docs/docs.go before each build, after the pre_build
+hooks. Only the controllers and models changed since the previous build are
+parsed again and the file is left untouched when the docs did not change.
+
+-restart=on-failure restarts the app when it exits with an error, waiting
+1s, 2s, 4s... up to 30s between attempts, and gives up after
+restart.max_crashes crashes within restart.crash_window seconds until the next
+change. -restart=always restarts it on any exit, the default is
+restart.policy of fire.json, "no".
+
+-test runs go test, alongside each build, for the packages affected by the
+changes: the ones changed and those importing them, directly or not. With
+test.block of fire.json the app is only restarted when they pass. test.args
+are passed to go test, e.g. ["-race"].
+
+-debug builds the app without optimizations and starts it under a headless
+Delve server on debug.host and debug.port of fire.json, 127.0.0.1:2345 by
+default, or -debugport. The server is started again on the same address
+after each build so the debugger of the IDE can stay attached, with
+--accept-multiclient. restart.signal is sent to dlv, which stops the app.
+
+-poll=500ms lists the watched directories every 500ms instead of relying on
+file system notifications, which do not work on Docker bind mounts, NFS or
+Vagrant shared folders. Polling is used as well when notifications fail.
+
+-livereload reloads the open browser tabs after each successful restart.
+Changes of watched files other than .go ones, e.g. templates, only reload
+the tabs. With -proxy the script is injected into the HTML pages of the app,
+otherwise the events are served on ` + liveReloadAddr + ` and the page has to
+include <script src="http://` + liveReloadAddr + `/__livereload.js"></script>.
+
 `,
 }
 
@@ -38,12 +110,29 @@ var mainFiles ListOpts
 
 var downdoc docValue
 var gendoc docValue
+var envName docValue
+var proxyAddr docValue
+var liveReloadOn bool
+var poll docValue
+var restartPolicy docValue
+var testOn bool
+var debugOn bool
+var debugPort docValue
 
 func init() {
 	cmdRun.Run = runApp
 	cmdRun.Flag.Var(&mainFiles, "main", "specify main go files")
 	cmdRun.Flag.Var(&gendoc, "gendoc", "auto generate the docs")
 	cmdRun.Flag.Var(&downdoc, "downdoc", "auto download swagger file when not exist")
+	cmdRun.Flag.Var(&envName, "env", "load .env.<env> on top of .env")
+	cmdRun.Flag.Var(&profile, "profile", "profile of fire.json to use")
+	cmdRun.Flag.Var(&proxyAddr, "proxy", "address of a reverse proxy to the app holding requests during restarts")
+	cmdRun.Flag.Var(&restartPolicy, "restart", "restart the app when it exits: no, on-failure or always")
+	cmdRun.Flag.Var(&poll, "poll", "poll for changes at the given interval, e.g. 500ms")
+	cmdRun.Flag.BoolVar(&debugOn, "debug", false, "run the app under a headless dlv server")
+	cmdRun.Flag.Var(&debugPort, "debugport", "port of the dlv server, overrides debug.port")
+	cmdRun.Flag.BoolVar(&testOn, "test", false, "test the packages affected by each change")
+	cmdRun.Flag.BoolVar(&liveReloadOn, "livereload", false, "reload the browser tabs after a restart")
 }
 
 var appname string
@@ -62,23 +151,53 @@ func runApp(cmd *Command, args []string) int {
 
 	err := loadConfig()
 	if err != nil {
-		helper.ColorLog("[ERRO] Fail to parse bee.json[ %s ]\n", err)
+		helper.ColorLog("[ERRO] Fail to parse fire.json[ %s ]\n", err)
+	}
+	for _, arg := range args {
+		if arg == "watchall" {
+			conf.DirStruct.WatchAll = true
+		}
+	}
+	watchIgnore = loadWatchIgnore()
+	loadWatchActions()
+	switch restartPolicy {
+	case "", restartNo, restartOnFailure, restartAlways:
+	default:
+		helper.ColorLog("[ERRO] Invalid 'restart' option: %s\n", restartPolicy)
+		helper.ColorLog("[HINT] Use one of no, on-failure or always\n")
+		os.Exit(2)
+	}
+	if debugOn {
+		initDebug()
+	}
+	if poll != "" {
+		pollInterval, err = time.ParseDuration(poll.String())
+		if err != nil || pollInterval <= 0 {
+			helper.ColorLog("[ERRO] Invalid 'poll' option: %s\n", poll)
+			helper.ColorLog("[HINT] Use a duration such as 500ms or 1s\n")
+			os.Exit(2)
+		}
 	}
 
-	var paths []string
-
-	readAppDirectories(crupath, &paths)
+	paths := appWatchPaths(crupath)
 
-	// Because monitor files has some issues, we watch current directory
-	// and ignore non-go files.
-	gps := helper.GetGOPATHs()
-	if len(gps) == 0 {
-		helper.ColorLog("[ERRO] Fail to start[ %s ]\n", "$GOPATH is not set or empty")
-		os.Exit(2)
+	if liveReloadOn {
+		liveReload = newReloadHub()
+		if proxyAddr == "" {
+			go func() {
+				err := http.ListenAndServe(liveReloadAddr, liveReload)
+				helper.ColorLog("[ERRO] Fail to serve live reload[ %s ]\n", err)
+			}()
+			helper.ColorLog("[INFO] Live reload on http://%s/__livereload.js\n", liveReloadAddr)
+		}
 	}
-	gopath := gps[0]
-	for _, p := range conf.DirStruct.Others {
-		paths = append(paths, strings.Replace(p, "$GOPATH", gopath, -1))
+	if proxyAddr != "" {
+		devProxy, err = startProxy(proxyAddr.String())
+		if err != nil {
+			helper.ColorLog("[ERRO] Fail to start the proxy[ %s ]\n", err)
+			os.Exit(2)
+		}
+		helper.ColorLog("[INFO] Proxying %s to the app on :%s\n", proxyAddr, devProxy.port)
 	}
 
 	files := []string{}
@@ -89,12 +208,12 @@ func runApp(cmd *Command, args []string) int {
 	}
 
 	if gendoc == "true" {
-		NewWatcher(paths, files, true)
-		Autobuild(files, true)
-	} else {
-		NewWatcher(paths, files, false)
-		Autobuild(files, false)
+		docsCache = generator.NewDocsCache()
 	}
+	NewWatcher(paths, func(changed []string) {
+		runActions(changed, files)
+	})
+	Autobuild(files, nil)
 	if downdoc == "true" {
 		if _, err := os.Stat(path.Join(crupath, "swagger")); err != nil {
 			if os.IsNotExist(err) {
@@ -112,31 +231,81 @@ func runApp(cmd *Command, args []string) int {
 	return 0
 }
 
-func readAppDirectories(directory string, paths *[]string) {
+// appWatchPaths returns the directories of the app and dir_structure.others
+// to watch.
+func appWatchPaths(crupath string) []string {
+	var paths []string
+
+	readAppDirectories(crupath, conf.DirStruct.WatchAll, &paths)
+
+	// Because monitor files has some issues, we watch current directory
+	// and ignore non-go files.
+	gps := helper.GetGOPATHs()
+	if len(gps) == 0 {
+		helper.ColorLog("[ERRO] Fail to start[ %s ]\n", "$GOPATH is not set or empty")
+		os.Exit(2)
+	}
+	gopath := gps[0]
+	for _, p := range conf.DirStruct.Others {
+		paths = append(paths, strings.Replace(p, "$GOPATH", gopath, -1))
+	}
+	return paths
+}
+
+// readAppDirectories appends directory and its sub directories to paths,
+// skipping the excluded ones and, unless all, the ones without files
+// triggering builds.
+func readAppDirectories(directory string, all bool, paths *[]string) {
+	if isExcludedDir(directory) {
+		return
+	}
 	fileInfos, err := ioutil.ReadDir(directory)
 	if err != nil {
 		return
 	}
 
-	useDirectory := false
+	if all || hasWatchedFiles(directory) {
+		*paths = append(*paths, directory)
+	}
 	for _, fileInfo := range fileInfos {
-		if strings.HasSuffix(fileInfo.Name(), "docs") {
-			continue
-		}
-		if fileInfo.IsDir() == true && fileInfo.Name()[0] != '.' {
-			readAppDirectories(directory + "/" + fileInfo.Name(), paths)
-			continue
+		if fileInfo.IsDir() {
+			readAppDirectories(path.Join(directory, fileInfo.Name()), all, paths)
 		}
+	}
+}
 
-		if useDirectory == true {
-			continue
-		}
+// watchIgnore holds the exclude rules of the watcher.
+var watchIgnore *helper.Ignore
 
-		if path.Ext(fileInfo.Name()) == ".go" {
-			*paths = append(*paths, directory)
-			useDirectory = true
+// loadWatchIgnore returns the rules of watch.exclude, .gitignore and
+// .fireignore, in that order.
+func loadWatchIgnore() *helper.Ignore {
+	ig := helper.NewIgnore(conf.Watch.Exclude)
+	for _, name := range []string{".gitignore", ".fireignore"} {
+		if err := ig.AddFile(name); err != nil {
+			helper.ColorLog("[WARN] Fail to read %s[ %s ]\n", name, err)
 		}
 	}
+	return ig
+}
 
-	return
+// isExcludedDir returns true for hidden directories and the ones ignored
+// by watchIgnore.
+func isExcludedDir(directory string) bool {
+	name := path.Base(directory)
+	if name[0] == '.' && name != "." {
+		return true
+	}
+	return isIgnored(directory, true)
+}
+
+// isIgnored returns true if the path is ignored by watchIgnore, paths out
+// of the app such as dir_structure.others are never ignored.
+func isIgnored(name string, isDir bool) bool {
+	crupath, _ := os.Getwd()
+	rel, err := path.Rel(crupath, name)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return watchIgnore.Match(path.ToSlash(rel), isDir)
 }
@@ -4,7 +4,7 @@ package stubs
 var controllerTemplate = `package controllers
 
 import (
-	"strconv"
+	{{strconvPkg}}
 	"encoding/json"
 	"{{pkgPath}}/models"
 
@@ -25,17 +25,19 @@ func (c *{{ctrlName}}Controller) URLMapping() {
 }
 
 // @Title Create new data
+// @Param body body models.Create{{ctrlName}}Input true "The {{ctrlName}} content"
 // @Success 200 {int} models.{{ctrlName}}
 // @Failure 403 body is empty
 // @router / [post]
 func (c *{{ctrlName}}Controller) Post() {
-	var v models.{{ctrlName}}
+	var in models.Create{{ctrlName}}Input
 	var response helper.APIResponse
 
-	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &v); err == nil {
-		if valid := response.Validator(&v); valid != false {
-			if _, err := models.Add{{ctrlName}}(&v); err == nil {
-				response.Success(1, v)
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &in); err == nil {
+		m := in.Model()
+		if valid := response.Validator(m); valid != false {
+			if _, err := models.Add{{ctrlName}}(m); err == nil {
+				response.Success(1, m)
 			} else {
 				response.Failed(400, err.Error())
 			}
@@ -57,7 +59,7 @@ func (c *{{ctrlName}}Controller) GetOne() {
 	response := helper.APIResponse{}
 
 	idStr := c.Ctx.Input.Param(":id")
-	id, _ := strconv.Atoi(idStr)
+	{{parseId}}
 	if data, err := models.Get{{ctrlName}}ById(id); err == nil {
 		response.Success(1, data)
 	} else {
@@ -88,6 +90,8 @@ func (c *{{ctrlName}}Controller) GetAll() {
 }
 
 // @Title Update model with provided key and new values
+// @Param id path {{pkType}} true "The id of the {{ctrlName}} to update"
+// @Param body body models.Update{{ctrlName}}Input true "The fields to update"
 // @Success 200 {object} models.{{ctrlName}}
 // @Failure 403 :id is not int
 // @router /:id [put]
@@ -95,12 +99,15 @@ func (c *{{ctrlName}}Controller) Put() {
 	response := helper.APIResponse{}
 
 	idStr := c.Ctx.Input.Param(":id")
-	id, _ := strconv.Atoi(idStr)
-	v := models.{{ctrlName}}{Id: id}
-	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &v); err == nil {
-		keys := helper.GetInputKeys(c.Ctx.Input.RequestBody)
-		if valid := response.Validator(&v); valid != false {
-			if err := models.Update{{ctrlName}}ById(&v, keys); err == nil {
+	{{parseId}}
+	var in models.Update{{ctrlName}}Input
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &in); err == nil {
+		m := &models.{{ctrlName}}{Id: id}
+		keys := in.Apply(m)
+		if len(keys) == 0 {
+			response.Failed(400, "body has no field to update")
+		} else if valid := response.Validator(m); valid != false {
+			if err := models.Update{{ctrlName}}ById(m, keys); err == nil {
 				response.Success(0, nil)
 			} else {
 				response.Failed(404, err.Error())
@@ -123,7 +130,7 @@ func (c *{{ctrlName}}Controller) Delete() {
 	response := helper.APIResponse{}
 
 	idStr := c.Ctx.Input.Param(":id")
-	id, _ := strconv.Atoi(idStr)
+	{{parseId}}
 	v := models.{{ctrlName}}{Id: id}
 	if err := models.Delete{{ctrlName}}(&v); err == nil {
 		response.Success(0, nil)
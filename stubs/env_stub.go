@@ -7,11 +7,10 @@ API_PORT=8080
 API_KEY=123456
 API_VERSION=1
 API_RUNMODE=dev
-DB_HOST=localhost
-DB_NAME={{.database}}
-DB_USER=root
-DB_PASS=`
+DB_DRIVER={{.Driver}}
+{{.DbEnv}}
+`
 
 func TemplateEnv() string {
 	return envTemplate
-}
\ No newline at end of file
+}
@@ -4,7 +4,11 @@ var mainTemplate = `package main
 
 import (
 	"os"
+	"fmt"
 	"time"
+	"strings"
+	"net/url"
+	"io/ioutil"
 
 	"github.com/qasico/beego"
 	"github.com/qasico/beego/orm"
@@ -12,12 +16,13 @@ import (
 
 	_ "{{.Appname}}/docs"
 	_ "{{.Appname}}/routers"
-	_ "github.com/go-sql-driver/mysql"
+	{{.DriverPkg}}
 )
 
 func init() {
-	orm.RegisterDataBase("default", "mysql", os.Getenv("DB_USER") + ":" + os.Getenv("DB_PASS") + "@tcp(" + os.Getenv("DB_HOST") + ":3306)/" + os.Getenv("DB_NAME") + "?charset=utf8&loc=Asia%2FJakarta") 
-	
+	loadEnv()
+	orm.RegisterDataBase("default", "{{.DriverName}}", dataSource())
+
 	orm.DefaultRelsDepth = 3
 	orm.DefaultTimeLoc   = time.Local
 
@@ -36,8 +41,221 @@ func main() {
 	}))
 
 	beego.Run()
+}
+
+// loadEnv sets the variables of the .env files of the working directory,
+// .env.<APP_ENV> taking precedence over .env. Variables already present in
+// the environment, e.g. passed by fire run, are left untouched.
+func loadEnv() {
+	files := []string{".env"}
+	if env := os.Getenv("APP_ENV"); env != "" {
+		files = append([]string{".env." + env}, files...)
+	}
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		keys, values, err := parseEnv(string(data), os.LookupEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			continue
+		}
+		for _, key := range keys {
+			if _, ok := os.LookupEnv(key); !ok {
+				os.Setenv(key, values[key])
+			}
+		}
+	}
+}
+` + envParser + `
+
+// getenv returns the environment variable key or def when it is empty.
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+{{.DataSource}}`
+
+// envParser is the .env parser of the generated main.go, following the
+// rules of helper.ParseEnv so the app reads the values fire does.
+var envParser = `
+// parseEnv parses the KEY=VALUE lines of a .env file, blank lines, lines
+// starting with # and a leading "export " are ignored. Values may be single
+// quoted (taken literally), double quoted (supporting \n, \t, \", \$ and \\
+// escapes) or bare, in which case a trailing " # comment" is dropped.
+// ${VAR} and $VAR are expanded in double quoted and bare values, looking up
+// the keys parsed so far first and then lookup.
+func parseEnv(data string, lookup func(string) (string, bool)) (keys []string, values map[string]string, err error) {
+	values = make(map[string]string)
+	expand := func(key string) string {
+		if v, ok := values[key]; ok {
+			return v
+		}
+		v, _ := lookup(key)
+		return v
+	}
+	for n, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, nil, fmt.Errorf("line %d: expected KEY=VALUE", n + 1)
+		}
+		key := strings.TrimSpace(line[:i])
+		value, err := parseEnvValue(strings.TrimSpace(line[i + 1:]), expand)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", n + 1, err)
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+	return keys, values, nil
+}
+
+func parseEnvValue(raw string, expand func(string) string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '\'':
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+		return raw[1:end + 1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '\\' && i + 1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '$':
+					// keep escaped dollars away from os.Expand
+					b.WriteString("$$")
+				default:
+					b.WriteByte(raw[i])
+				}
+			case c == '"':
+				return expandEnv(b.String(), expand), nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quoted value")
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return expandEnv(raw, expand), nil
+}
+
+// expandEnv replaces ${VAR} and $VAR by their values, $$ being a literal $.
+func expandEnv(s string, expand func(string) string) string {
+	return os.Expand(s, func(key string) string {
+		if key == "$" {
+			return "$"
+		}
+		return expand(key)
+	})
 }`
 
+var mysqlDataSource = `
+// dataSource builds the mysql DSN from the DB_* environment variables.
+func dataSource() string {
+	return os.Getenv("DB_USER") + ":" + os.Getenv("DB_PASS") +
+		"@tcp(" + os.Getenv("DB_HOST") + ":" + getenv("DB_PORT", "3306") + ")/" + os.Getenv("DB_NAME") +
+		"?charset=utf8&loc=" + url.QueryEscape(getenv("DB_TIMEZONE", "Local"))
+}`
+
+var postgresDataSource = `
+// dataSource builds the postgres DSN from the DB_* environment variables.
+func dataSource() string {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(os.Getenv("DB_USER"), os.Getenv("DB_PASS")),
+		Host:   os.Getenv("DB_HOST") + ":" + getenv("DB_PORT", "5432"),
+		Path:   "/" + os.Getenv("DB_NAME"),
+	}
+	q := url.Values{}
+	q.Set("sslmode", getenv("DB_SSLMODE", "disable"))
+	if tz := os.Getenv("DB_TIMEZONE"); tz != "" {
+		q.Set("timezone", tz)
+	}
+	dsn.RawQuery = q.Encode()
+	return dsn.String()
+}`
+
+var sqliteDataSource = `
+// dataSource builds the sqlite DSN from the DB_* environment variables,
+// DB_NAME being the path of the database file.
+func dataSource() string {
+	return "file:" + os.Getenv("DB_NAME") + "?_loc=" + url.QueryEscape(getenv("DB_TIMEZONE", "auto"))
+}`
+
+// Driver describes how a generated app connects to its database.
+type Driver struct {
+	// Name is the driver name registered with the orm, Pkg the import of
+	// the sql driver.
+	Name       string
+	Pkg        string
+	DataSource string
+	// Env holds the DB_* lines of the .env file.
+	Env        string
+}
+
+var drivers = map[string]*Driver{
+	"mysql": {
+		Name:       "mysql",
+		Pkg:        `_ "github.com/go-sql-driver/mysql"`,
+		DataSource: mysqlDataSource,
+		Env: `DB_HOST=localhost
+DB_PORT=3306
+DB_NAME={{.database}}
+DB_USER=root
+DB_PASS=
+DB_TIMEZONE=Asia/Jakarta`,
+	},
+	"postgres": {
+		Name:       "postgres",
+		Pkg:        `_ "github.com/lib/pq"`,
+		DataSource: postgresDataSource,
+		Env: `DB_HOST=localhost
+DB_PORT=5432
+DB_NAME={{.database}}
+DB_USER=postgres
+DB_PASS=postgres
+DB_SSLMODE=disable
+DB_TIMEZONE=Asia/Jakarta`,
+	},
+	"sqlite": {
+		Name:       "sqlite3",
+		Pkg:        `_ "github.com/mattn/go-sqlite3"`,
+		DataSource: sqliteDataSource,
+		Env: `DB_NAME={{.database}}.db
+DB_TIMEZONE=Asia/Jakarta`,
+	},
+}
+
 func TemplateMain() string {
 	return mainTemplate
-}
\ No newline at end of file
+}
+
+// TemplateDriver returns the driver by its fire name: mysql, postgres or sqlite.
+func TemplateDriver(name string) (*Driver, bool) {
+	d, ok := drivers[name]
+	return d, ok
+}
@@ -0,0 +1,154 @@
+package stubs
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"os/exec"
+	"io/ioutil"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/qasico/fire/helper"
+)
+
+// envFixtures are .env files parsed by both helper.ParseEnv and the parser
+// of the generated main.go.
+var envFixtures = []string{
+	`# database
+export DB_HOST=127.0.0.1
+DB_PORT = 3306 # default port
+DB_PASS="a#b"
+DB_USER='root # not a comment'
+DB_NAME="say \"hi\"\tto\n$HOME"
+DB_DSN=${DB_USER}@${DB_HOST}:$DB_PORT
+DB_LITERAL="\$HOME\\"
+DB_EMPTY=
+DB_HOST=localhost
+`,
+	"A=1\r\nB=\"2\" # two\r\n",
+	"A=1\nNOEQUALS\n",
+	"A='unterminated\n",
+	`A="unterminated\"`,
+}
+
+// envCheck runs envParser on the files given as arguments and prints the
+// results as json.
+const envCheck = `package main
+
+import (
+	"os"
+	"fmt"
+	"strings"
+	"io/ioutil"
+	"encoding/json"
+)
+
+type result struct {
+	Keys   []string
+	Values map[string]string
+	Err    string
+}
+
+func main() {
+	var results []result
+	for _, name := range os.Args[1:] {
+		data, _ := ioutil.ReadFile(name)
+		keys, values, err := parseEnv(string(data), lookup)
+		r := result{Keys: keys, Values: values}
+		if err != nil {
+			r.Err = err.Error()
+		}
+		results = append(results, r)
+	}
+	json.NewEncoder(os.Stdout).Encode(results)
+}
+
+func lookup(key string) (string, bool) {
+	if key == "HOME" {
+		return "/home/fire", true
+	}
+	return "", false
+}
+`
+
+type envResult struct {
+	Keys   []string
+	Values map[string]string
+	Err    string
+}
+
+func TestMainEnvParserMatchesHelper(t *testing.T) {
+	if !strings.Contains(TemplateMain(), envParser) {
+		t.Fatal("the main template does not include envParser")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+	dir, err := ioutil.TempDir("", "fire-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		fpath := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fpath
+	}
+	write("go.mod", "module envcheck\n\ngo 1.10\n")
+	write("main.go", envCheck + envParser)
+	args := []string{"run", "."}
+	for i, fixture := range envFixtures {
+		args = append(args, write(".env" + string(rune('a' + i)), fixture))
+	}
+	c := exec.Command(gobin, args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "GOFLAGS=", "GO111MODULE=on")
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	var generated []envResult
+	if err := json.Unmarshal(out, &generated); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	if len(generated) != len(envFixtures) {
+		t.Fatalf("got %d results for %d fixtures", len(generated), len(envFixtures))
+	}
+
+	lookup := func(key string) (string, bool) {
+		if key == "HOME" {
+			return "/home/fire", true
+		}
+		return "", false
+	}
+	for i, fixture := range envFixtures {
+		keys, values, err := helper.ParseEnv(strings.NewReader(fixture), lookup)
+		want := envResult{Keys: keys, Values: values}
+		if err != nil {
+			want = envResult{Err: err.Error()}
+		}
+		got := generated[i]
+		if got.Err != "" {
+			got.Keys, got.Values = nil, nil
+		}
+		if !envEqual(got, want) {
+			t.Errorf("fixture %d:\n%s\ngenerated parser: %+v\nhelper.ParseEnv:  %+v", i, fixture, got, want)
+		}
+	}
+}
+
+func envEqual(a, b envResult) bool {
+	if a.Err != b.Err || strings.Join(a.Keys, "\x00") != strings.Join(b.Keys, "\x00") || len(a.Values) != len(b.Values) {
+		return false
+	}
+	for k, v := range a.Values {
+		if b.Values[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -17,6 +17,27 @@ func (t *{{modelName}}) TableName() string {
 	return "{{tableName}}"
 }
 
+// Create{{modelName}}Input is the request body accepted when creating a {{modelName}},
+// it also carries the sensitive fields hidden from responses.
+type Create{{modelName}}Input struct {
+{{createFields}}}
+
+// Model returns the {{modelName}} to be created from the input.
+func (in *Create{{modelName}}Input) Model() *{{modelName}} {
+	m := new({{modelName}})
+{{createCopy}}	return m
+}
+
+// Update{{modelName}}Input is the request body accepted when updating a {{modelName}},
+// only the fields present in the body are updated.
+type Update{{modelName}}Input struct {
+{{updateFields}}}
+
+// Apply copies the provided fields onto m and returns their column names.
+func (in *Update{{modelName}}Input) Apply(m *{{modelName}}) (keys []string) {
+{{updateCopy}}	return
+}
+
 func init() {
 	orm.RegisterModel(new({{modelName}}))
 }
@@ -27,7 +48,7 @@ func Add{{modelName}}(m *{{modelName}}) (id int64, err error) {
 	return
 }
 
-func Get{{modelName}}ById(id int) (v *{{modelName}}, err error) {
+func Get{{modelName}}ById(id {{pkType}}) (v *{{modelName}}, err error) {
 	var m {{modelName}}
 	o := orm.NewOrm()
 
@@ -71,6 +92,10 @@ func GetAll{{modelName}}(query map[int]map[string]string, fields []string, group
 				m := make(map[string]interface{})
 				val := reflect.ValueOf(v)
 				for _, fname := range fields {
+					// never expose fields hidden from json, e.g. sensitive columns
+					if f, ok := val.Type().FieldByName(helper.CamelString(fname)); ok && f.Tag.Get("json") == "-" {
+						continue
+					}
 					m[fname] = val.FieldByName(helper.CamelString(fname)).Interface()
 				}
 				result = append(result, m)
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/qasico/fire/helper"
+)
+
+// Values of restart.policy and -restart.
+const (
+	restartNo        = "no"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+// maxCrashBackoff bounds the delay between two automatic restarts.
+const maxCrashBackoff = 30 * time.Second
+
+// supervisor tracks the exits of the app not requested by Kill.
+var supervisor struct {
+	mu       sync.Mutex
+	// stopping is the process Kill is stopping, its exit is expected.
+	stopping *exec.Cmd
+	// crashes holds the times of the recent crashes.
+	crashes  []time.Time
+}
+
+// expectExit marks the exit of c as requested.
+func expectExit(c *exec.Cmd) {
+	supervisor.mu.Lock()
+	supervisor.stopping = c
+	supervisor.mu.Unlock()
+}
+
+// resetCrashes forgets the crashes, e.g. once the sources changed.
+func resetCrashes() {
+	supervisor.mu.Lock()
+	supervisor.crashes = nil
+	supervisor.mu.Unlock()
+}
+
+// appExited reports an unexpected exit of the process c and restarts it
+// according to restart.policy, backing off exponentially. After
+// restart.max_crashes crashes within restart.crash_window it gives up until
+// the next change. Meanwhile the proxy holds the requests, or serves the
+// crash once it gave up or when the app is not restarted.
+func appExited(c *exec.Cmd, err error, stderr *tailBuffer) {
+	supervisor.mu.Lock()
+	expected := supervisor.stopping == c
+	supervisor.mu.Unlock()
+	if expected {
+		return
+	}
+
+	status := c.ProcessState.String()
+	if err != nil && c.ProcessState == nil {
+		status = err.Error()
+	}
+	failed := !c.ProcessState.Success()
+	if failed {
+		helper.ColorLog("[ERRO] %s exited[ %s ]\n", appname, status)
+		if tail := strings.TrimSpace(stderr.String()); tail != "" {
+			helper.ColorLog("[ERRO] Last output of %s:\n%s\n", appname, tail)
+		}
+	} else {
+		helper.ColorLog("[WARN] %s exited[ %s ]\n", appname, status)
+	}
+
+	policy := conf.Restart.Policy
+	if restartPolicy != "" {
+		policy = restartPolicy.String()
+	}
+	restart := policy == restartAlways || (policy == restartOnFailure && failed)
+
+	n := 0
+	window := time.Duration(conf.Restart.CrashWindow) * time.Second
+	if restart {
+		now := time.Now()
+		supervisor.mu.Lock()
+		recent := supervisor.crashes[:0]
+		for _, t := range supervisor.crashes {
+			if now.Sub(t) < window {
+				recent = append(recent, t)
+			}
+		}
+		supervisor.crashes = append(recent, now)
+		n = len(supervisor.crashes)
+		supervisor.mu.Unlock()
+	}
+	gaveUp := restart && conf.Restart.MaxCrashes > 0 && n > conf.Restart.MaxCrashes
+
+	// under the state lock, like appReady, so the requests are never
+	// released to c once it exited
+	state.Lock()
+	// a build or restart may have replaced the process meanwhile
+	current := cmd == c
+	if current && restart && !gaveUp {
+		devProxy.hold()
+	} else if current {
+		serveCrash(stderr.String(), fmt.Errorf("%s exited[ %s ]", appname, status))
+	}
+	state.Unlock()
+	if gaveUp {
+		helper.ColorLog("[ERRO] %s crashed %d times within %s, waiting for changes\n", appname, n, window)
+	}
+	if !current || !restart || gaveUp {
+		return
+	}
+
+	delay := time.Second << uint(n - 1)
+	if delay > maxCrashBackoff || delay <= 0 {
+		delay = maxCrashBackoff
+	}
+	helper.ColorLog("[INFO] Restarting %s in %s\n", appname, delay)
+	time.Sleep(delay)
+
+	state.Lock()
+	defer state.Unlock()
+	// a build or restart may have replaced the process meanwhile
+	if cmd != c {
+		return
+	}
+	Start(appname)
+}
+
+// appReady lets the proxy forward requests to the app process of done. It
+// takes the state lock like appExited, so that a process exiting right
+// after it got ready does not get the requests released to it.
+func appReady(done chan struct{}) {
+	state.Lock()
+	defer state.Unlock()
+	select {
+	case <-done:
+		// appExited holds the requests or serves the crash
+		return
+	default:
+	}
+	devProxy.releaseApp(done)
+}
+
+// serveCrash makes the proxy serve the output of the crashed app, or err
+// if there is none, until the app is started again.
+func serveCrash(output string, err error) {
+	if devProxy != nil {
+		if strings.TrimSpace(output) == "" {
+			output = err.Error()
+		}
+		f := parseBuildErrors(output)
+		f.Title = appname + " crashed"
+		f.crash = true
+		devProxy.fail(f)
+		helper.ColorLog("[INFO] Serving the crash of %s on %s\n", appname, proxyAddr)
+		liveReload.reload()
+	}
+	devProxy.release()
+}
+
+// tailBuffer keeps the last bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf) - t.max:]
+		// start at a whole line
+		if i := bytes.IndexByte(t.buf, '\n'); i >= 0 {
+			t.buf = t.buf[i + 1:]
+		}
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
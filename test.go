@@ -0,0 +1,375 @@
+package main
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"sort"
+	"sync"
+	"bytes"
+	"errors"
+	"context"
+	"os/exec"
+	"strings"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+
+	"github.com/qasico/fire/helper"
+)
+
+var cmdTest = &Command{
+	UsageLine: "test [-watch] [-profile=dev]",
+	Short:     "run the tests of the app",
+	Long: `
+Test command runs go test for all the packages of the app and sums up the
+passed, failed and skipped tests, printing the output of the failed ones.
+
+-watch keeps watching the app like fire run does and, on each change, tests
+the packages affected by it: the ones changed and those importing them,
+directly or not.
+
+test.args of fire.json are passed to go test, e.g. ["-race", "-count=1"].
+`,
+}
+
+var testWatch bool
+
+func init() {
+	cmdTest.Run = testApp
+	cmdTest.Flag.BoolVar(&testWatch, "watch", false, "test the packages affected by each change")
+	cmdTest.Flag.Var(&profile, "profile", "profile of fire.json to use")
+}
+
+func testApp(cmd *Command, args []string) int {
+	crupath, _ := os.Getwd()
+	appname = filepath.Base(crupath)
+	if err := loadConfig(); err != nil {
+		helper.ColorLog("[ERRO] Fail to parse fire.json[ %s ]\n", err)
+	}
+
+	report := <-startTests(nil)
+	if !testWatch {
+		if report != nil && !report.ok() {
+			return 1
+		}
+		return 0
+	}
+
+	watchIgnore = loadWatchIgnore()
+	loadWatchActions()
+	NewWatcher(appWatchPaths(crupath), func(changed []string) {
+		startTests(changed)
+	})
+	select {}
+}
+
+// errTestsFailed stops a build whose tests failed with test.block.
+var errTestsFailed = errors.New("tests failed")
+
+var (
+	// testMu guards testCancel, which cancels the latest test run, testRun,
+	// its number, and testPending, the changes not tested yet.
+	testMu sync.Mutex
+	testCancel context.CancelFunc
+	testRun int
+	testPending changeSet
+)
+
+// startTests cancels the test run in progress, if any, and tests the
+// packages affected by the changed files, all of them if changed is nil,
+// along with the changes of the canceled runs. The report is sent on the
+// returned channel, nil if no package was tested.
+func startTests(changed []string) <-chan *testReport {
+	ctx, cancel := context.WithCancel(context.Background())
+	testMu.Lock()
+	if testCancel != nil {
+		testCancel()
+	}
+	testCancel = cancel
+	testRun++
+	run := testRun
+	testPending.add(changed)
+	changed = testPending.files()
+	testMu.Unlock()
+
+	reports := make(chan *testReport, 1)
+	go func() {
+		defer cancel()
+		report := testChanged(ctx, changed)
+		testMu.Lock()
+		// a newer run tests these changes again
+		if run == testRun && ctx.Err() == nil {
+			testPending.reset()
+		}
+		testMu.Unlock()
+		reports <- report
+	}()
+	return reports
+}
+
+// testChanged tests the packages affected by the changed files and logs
+// the report.
+func testChanged(ctx context.Context, changed []string) *testReport {
+	pkgs, err := listPackages(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			helper.ColorLog("[WARN] Fail to list the packages[ %s ]\n", err)
+		}
+		return nil
+	}
+	affected := affectedPackages(pkgs, changed)
+	if len(affected) == 0 {
+		helper.ColorLog("[SKIP] # No tests affected by the changes #\n")
+		return nil
+	}
+	helper.ColorLog("[INFO] Testing %d packages...\n", len(affected))
+	report, err := goTest(ctx, affected)
+	if err != nil {
+		if ctx.Err() == nil {
+			helper.ColorLog("[WARN] Fail to run the tests[ %s ]\n", err)
+		}
+		return nil
+	}
+	report.log()
+	return report
+}
+
+// goPackage is a package of the app as listed by go list -json.
+type goPackage struct {
+	ImportPath   string
+	Dir          string
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+}
+
+// listPackages returns the packages of the app.
+func listPackages(ctx context.Context) ([]*goPackage, error) {
+	c := exec.CommandContext(ctx, "go", "list", "-e", "-json", "./...")
+	stderr := new(bytes.Buffer)
+	c.Stderr = stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	var pkgs []*goPackage
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		p := new(goPackage)
+		if err := dec.Decode(p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// affectedPackages returns the import paths of the packages with tests that
+// are affected by the changed files, relative to the app: the packages
+// holding them, the ones importing those, directly or not, and the ones
+// whose tests import any of them. All the packages are affected when
+// changed is nil or go.mod changed.
+func affectedPackages(pkgs []*goPackage, changed []string) []string {
+	crupath, _ := os.Getwd()
+	affected := make(map[string]bool)
+	var queue []string
+	mark := func(p string) {
+		if !affected[p] {
+			affected[p] = true
+			queue = append(queue, p)
+		}
+	}
+
+	for _, p := range pkgs {
+		if changed == nil {
+			mark(p.ImportPath)
+		}
+	}
+	for _, name := range changed {
+		base := filepath.Base(name)
+		abs := filepath.Join(crupath, name)
+		for _, p := range pkgs {
+			switch {
+			case base == "go.mod" || base == "go.sum":
+				mark(p.ImportPath)
+			case strings.HasSuffix(name, ".go"):
+				if p.Dir == filepath.Dir(abs) {
+					mark(p.ImportPath)
+				}
+			case p.Dir == abs || strings.HasPrefix(p.Dir, abs + string(os.PathSeparator)):
+				// a directory created or removed
+				mark(p.ImportPath)
+			}
+		}
+	}
+
+	importers := make(map[string][]string)
+	testImporters := make(map[string][]string)
+	for _, p := range pkgs {
+		for _, imp := range p.Imports {
+			importers[imp] = append(importers[imp], p.ImportPath)
+		}
+		for _, imp := range append(p.TestImports, p.XTestImports...) {
+			testImporters[imp] = append(testImporters[imp], p.ImportPath)
+		}
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, imp := range importers[p] {
+			mark(imp)
+		}
+	}
+	// tests are not imported, so their importers are not affected
+	for p := range affected {
+		for _, imp := range testImporters[p] {
+			affected[imp] = true
+		}
+	}
+
+	var paths []string
+	for _, p := range pkgs {
+		if affected[p.ImportPath] && len(p.TestGoFiles) + len(p.XTestGoFiles) > 0 {
+			paths = append(paths, p.ImportPath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// testEvent is an event of go test -json.
+type testEvent struct {
+	Action     string
+	Package    string
+	Test       string
+	Output     string
+	// ImportPath is set instead of Package for build-output events.
+	ImportPath string
+}
+
+// testReport sums up a go test run.
+type testReport struct {
+	Packages int
+	Passed   int
+	Failed   int
+	Skipped  int
+	Failures []testFailure
+}
+
+// testFailure is a failed test, or a package failing on its own, e.g. as it
+// does not build.
+type testFailure struct {
+	Name   string
+	Output string
+}
+
+func (r *testReport) ok() bool {
+	return len(r.Failures) == 0
+}
+
+// String returns the output of the failures.
+func (r *testReport) String() string {
+	var buf bytes.Buffer
+	for _, f := range r.Failures {
+		fmt.Fprintf(&buf, "--- FAIL: %s\n%s", f.Name, f.Output)
+	}
+	return buf.String()
+}
+
+// log logs the counts and the output of the failures.
+func (r *testReport) log() {
+	if r.ok() {
+		helper.ColorLog("[SUCC] Tests passed ( %d passed, %d skipped in %d packages )\n", r.Passed, r.Skipped, r.Packages)
+		return
+	}
+	for _, f := range r.Failures {
+		helper.ColorLog("[ERRO] --- FAIL: %s\n", f.Name)
+		fmt.Print(f.Output)
+	}
+	helper.ColorLog("[ERRO] Tests failed ( %d failed, %d passed, %d skipped in %d packages )\n", r.Failed, r.Passed, r.Skipped, r.Packages)
+}
+
+// goTest runs go test for pkgs with test.args.
+func goTest(ctx context.Context, pkgs []string) (*testReport, error) {
+	args := append([]string{"test", "-json"}, conf.Test.Args...)
+	c := exec.CommandContext(ctx, "go", append(args, pkgs...)...)
+	stderr := new(bytes.Buffer)
+	c.Stderr = stderr
+	out, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	report := &testReport{Packages: len(pkgs)}
+	// outputs holds the output of the tests and packages still running
+	outputs := make(map[string]*bytes.Buffer)
+	failed := make(map[string]bool)
+	dec := json.NewDecoder(out)
+	for {
+		var e testEvent
+		if err := dec.Decode(&e); err != nil {
+			break
+		}
+		name := e.Package
+		if e.Test != "" {
+			name += " " + e.Test
+		}
+		if e.Action == "build-output" && e.ImportPath != "" {
+			// e.g. "app/models [app/models.test]"
+			e.Action, name = "output", strings.Fields(e.ImportPath)[0]
+		}
+		switch e.Action {
+		case "output":
+			if outputs[name] == nil {
+				outputs[name] = new(bytes.Buffer)
+			}
+			outputs[name].WriteString(e.Output)
+		case "pass", "skip":
+			if e.Test != "" && e.Action == "pass" {
+				report.Passed++
+			} else if e.Test != "" {
+				report.Skipped++
+			}
+			delete(outputs, name)
+		case "fail":
+			if e.Test != "" {
+				report.Failed++
+				failed[e.Package] = true
+			}
+			// the output of a package whose tests failed repeats theirs
+			if e.Test != "" || !failed[e.Package] {
+				output := ""
+				if buf := outputs[name]; buf != nil {
+					output = buf.String()
+				}
+				report.Failures = append(report.Failures, testFailure{Name: name, Output: output})
+			}
+			delete(outputs, name)
+		}
+	}
+	io.Copy(ioutil.Discard, out)
+	err = c.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// e.g. packages not building before go 1.24 report on stderr only
+	if err != nil && report.ok() {
+		output := stderr.String()
+		if strings.TrimSpace(output) == "" {
+			output = err.Error() + "\n"
+		}
+		report.Failures = append(report.Failures, testFailure{Name: "go test", Output: output})
+	}
+	return report, nil
+}
@@ -15,108 +15,332 @@
 package main
 
 import (
+	"io"
 	"os"
-	"fmt"
-	"bytes"
+	"net"
+	"sort"
 	"sync"
 	"time"
+	"bytes"
+	"context"
 	"runtime"
 	"strings"
+	"syscall"
 	"os/exec"
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
 
 	"github.com/qasico/fire/helper"
 	"github.com/howeyc/fsnotify"
+	"github.com/qasico/fire/generator"
 )
 
 var (
 	cmd         *exec.Cmd
+	// exited is closed once the process of cmd has been reaped.
+	exited chan struct{}
+	// state serializes builds and restarts.
 	state sync.Mutex
-	buildPeriod time.Time
-	started = make(chan bool)
-	eventTime = make(map[string]int64)
+	// buildMu guards buildCancel, which cancels the latest build, and
+	// buildChanged, the changes not built yet.
+	buildMu sync.Mutex
+	buildCancel context.CancelFunc
+	buildChanged changeSet
+	// watched and fileHashes are only used by the goroutine of NewWatcher
+	// once started.
+	watched = make(map[string]bool)
+	fileHashes = make(map[string]string)
 )
 
-func NewWatcher(paths []string, files []string, isgenerate bool) {
+// buildDelay is the quiet window after the last event before a build starts,
+// so that saving several files at once builds once.
+var buildDelay = 300 * time.Millisecond
+
+// fileWatcher reports the changes of the files of the watched directories.
+type fileWatcher interface {
+	Watch(path string) error
+	RemoveWatch(path string) error
+	Events() <-chan watchEvent
+	Errors() <-chan error
+}
+
+// watchEvent is a change of the file or directory Name.
+type watchEvent struct {
+	Name   string
+	Create bool
+	// Remove is also set when the file is renamed.
+	Remove bool
+}
+
+// notifyWatcher is the fileWatcher using fsnotify.
+type notifyWatcher struct {
+	*fsnotify.Watcher
+	events chan watchEvent
+}
+
+func newNotifyWatcher() (*notifyWatcher, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		helper.ColorLog("[ERRO] Fail to create new Watcher[ %s ]\n", err)
-		os.Exit(2)
+		return nil, err
+	}
+	w := &notifyWatcher{Watcher: watcher, events: make(chan watchEvent)}
+	go func() {
+		for e := range watcher.Event {
+			w.events <- watchEvent{Name: e.Name, Create: e.IsCreate(), Remove: e.IsDelete() || e.IsRename()}
+		}
+	}()
+	return w, nil
+}
+
+func (w *notifyWatcher) Events() <-chan watchEvent {
+	return w.events
+}
+
+func (w *notifyWatcher) Errors() <-chan error {
+	return w.Error
+}
+
+// pollInterval is the interval of the polling watcher, fsnotify is used
+// when zero.
+var pollInterval time.Duration
+
+// NewWatcher watches paths and calls onChange with the files changed, relative
+// to the app, once no change arrived for buildDelay.
+func NewWatcher(paths []string, onChange func(changed []string)) {
+	helper.ColorLog("[INFO] Initializing watcher...\n")
+	var watcher fileWatcher
+	if pollInterval == 0 {
+		w, err := newNotifyWatcher()
+		if err == nil {
+			err = watchPaths(w, paths)
+		}
+		if err != nil {
+			helper.ColorLog("[WARN] Fail to watch with fsnotify[ %s ]\n", err)
+			if w != nil {
+				w.Close()
+			}
+			pollInterval = defaultPollInterval
+		} else {
+			watcher = w
+		}
+	}
+	if pollInterval > 0 {
+		helper.ColorLog("[INFO] Polling for changes every %s\n", pollInterval)
+		watcher = newPollWatcher(pollInterval)
+		if err := watchPaths(watcher, paths); err != nil {
+			helper.ColorLog("[ERRO] Fail to watch directory[ %s ]\n", err)
+			os.Exit(2)
+		}
 	}
 
 	go func() {
+		// pending holds the paths changed since the last build, true for
+		// directories, which always trigger a build.
+		pending := make(map[string]bool)
+		timer := time.NewTimer(buildDelay)
+		timer.Stop()
 		for {
 			select {
-			case e := <-watcher.Event:
-				isbuild := true
-
-			// Skip TMP files for Sublime Text.
-				if checkTMPFile(e.Name) {
-					continue
-				}
-				if !chekcIfWatchExt(e.Name) {
+			case e := <-watcher.Events():
+				if handled, rebuild := watchDirEvent(watcher, e); handled {
+					if rebuild {
+						pending[e.Name] = true
+						timer.Reset(buildDelay)
+					}
 					continue
 				}
 
-			// Prevent duplicated builds.
-				if buildPeriod.Add(1 * time.Second).After(time.Now()) {
+				if !isWatchedFile(e.Name) {
 					continue
 				}
-				buildPeriod = time.Now()
 
-				mt := getFileModTime(e.Name)
-				if t := eventTime[e.Name]; mt == t {
-					helper.ColorLog("[SKIP] # %s #\n", e.String())
-					isbuild = false
+				if _, ok := pending[e.Name]; !ok {
+					pending[e.Name] = false
 				}
-
-				eventTime[e.Name] = mt
-
-				if isbuild {
-					helper.ColorLog("[EVEN] %s\n", e)
-					go Autobuild(files, isgenerate)
+				timer.Reset(buildDelay)
+			case <-timer.C:
+				changed := changedFiles(pending)
+				pending = make(map[string]bool)
+				if len(changed) == 0 {
+					continue
 				}
-			case err := <-watcher.Error:
+				helper.ColorLog("[EVEN] Changed: %s\n", strings.Join(changed, ", "))
+				go onChange(changed)
+			case err := <-watcher.Errors():
 				helper.ColorLog("[WARN] %s\n", err.Error()) // No need to exit here
 			}
 		}
 	}()
+}
 
-	helper.ColorLog("[INFO] Initializing watcher...\n")
+// watchPaths watches the directories of the app.
+func watchPaths(watcher fileWatcher, paths []string) error {
 	for _, path := range paths {
 		helper.ColorLog("[TRAC] Directory( %s )\n", path)
-		err = watcher.Watch(path)
-		if err != nil {
-			helper.ColorLog("[ERRO] Fail to watch directory[ %s ]\n", err)
-			os.Exit(2)
+		if err := watcher.Watch(path); err != nil {
+			return err
 		}
+		watched[path] = true
+		hashDir(path)
 	}
+	return nil
+}
 
+// changedFiles returns the pending paths whose content differs from the last
+// build, relative to the app, updating fileHashes.
+func changedFiles(pending map[string]bool) (changed []string) {
+	crupath, _ := os.Getwd()
+	for name, isDir := range pending {
+		if !isDir {
+			sum, ok := hashFile(name)
+			if old, seen := fileHashes[name]; sum == old && ok == seen {
+				helper.ColorLog("[SKIP] # %s is unchanged #\n", name)
+				continue
+			}
+			if ok {
+				fileHashes[name] = sum
+			} else {
+				delete(fileHashes, name)
+			}
+		}
+		if rel, err := filepath.Rel(crupath, name); err == nil {
+			name = rel
+		}
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	return changed
 }
 
-// getFileModTime retuens unix timestamp of `os.File.ModTime` by given path.
-func getFileModTime(path string) int64 {
-	path = strings.Replace(path, "\\", "/", -1)
-	f, err := os.Open(path)
+// hashDir records the hashes of the files of directory triggering builds.
+func hashDir(directory string) {
+	f, err := os.Open(directory)
 	if err != nil {
-		helper.ColorLog("[ERRO] Fail to open file[ %s ]\n", err)
-		return time.Now().Unix()
+		return
 	}
-	defer f.Close()
+	names, _ := f.Readdirnames(-1)
+	f.Close()
+	for _, name := range names {
+		name = filepath.Join(directory, name)
+		if isWatchedFile(name) {
+			if sum, ok := hashFile(name); ok {
+				fileHashes[name] = sum
+			}
+		}
+	}
+}
 
-	fi, err := f.Stat()
+// hashFile returns the sha1 of the content of the file, ok is false when it
+// can not be read, e.g. after it has been removed.
+func hashFile(name string) (sum string, ok bool) {
+	f, err := os.Open(name)
 	if err != nil {
-		helper.ColorLog("[ERRO] Fail to get file information[ %s ]\n", err)
-		return time.Now().Unix()
+		return "", false
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", false
 	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
 
-	return fi.ModTime().Unix()
+// watchDirEvent watches directories created inside the app and drops the
+// watches of removed ones. handled is false for events not about
+// directories, rebuild is true when the directory holds or held sources.
+func watchDirEvent(watcher fileWatcher, e watchEvent) (handled, rebuild bool) {
+	switch {
+	case e.Create:
+		fi, err := os.Stat(e.Name)
+		if err != nil || !fi.IsDir() {
+			return false, false
+		}
+		var paths []string
+		// its files are yet to come, so it is watched whatever it holds
+		readAppDirectories(e.Name, true, &paths)
+		for _, path := range paths {
+			if watched[path] {
+				continue
+			}
+			helper.ColorLog("[TRAC] Directory( %s )\n", path)
+			if err := watcher.Watch(path); err != nil {
+				helper.ColorLog("[WARN] Fail to watch directory[ %s ]\n", err)
+				continue
+			}
+			watched[path] = true
+			// files may have been created before the watch was added
+			if !rebuild {
+				rebuild = hasWatchedFiles(path)
+			}
+			hashDir(path)
+		}
+		return true, rebuild
+	case e.Remove:
+		if !watched[e.Name] {
+			return false, false
+		}
+		for path := range watched {
+			if path == e.Name || strings.HasPrefix(path, e.Name + string(os.PathSeparator)) {
+				watcher.RemoveWatch(path)
+				delete(watched, path)
+			}
+		}
+		for name := range fileHashes {
+			if strings.HasPrefix(name, e.Name + string(os.PathSeparator)) {
+				delete(fileHashes, name)
+			}
+		}
+		return true, true
+	}
+	return false, false
+}
+
+// hasWatchedFiles returns true if directory contains a file triggering builds.
+func hasWatchedFiles(directory string) bool {
+	f, err := os.Open(directory)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	names, _ := f.Readdirnames(-1)
+	for _, name := range names {
+		if isWatchedFile(filepath.Join(directory, name)) {
+			return true
+		}
+	}
+	return false
 }
 
-func Autobuild(files []string, isgenerate bool) {
+// Autobuild builds the app and restarts it on success, running the hooks
+// of fire.json for the changed files, nil meaning all of them. A call
+// cancels the build or restart in progress, if any, so only the latest one
+// restarts the app; calls made while a canceled build is winding down are
+// superseded by later ones. The surviving build gets the changes of the ones
+// it superseded.
+func Autobuild(files []string, changed []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	buildMu.Lock()
+	if buildCancel != nil {
+		buildCancel()
+	}
+	buildCancel = cancel
+	buildChanged.add(changed)
+	buildMu.Unlock()
+	defer cancel()
+
 	state.Lock()
 	defer state.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	// the changes are dropped once built, see below
+	buildMu.Lock()
+	changed = buildChanged.files()
+	buildMu.Unlock()
 
 	helper.ColorLog("[INFO] Start building...\n")
+	devProxy.hold()
 	path, _ := os.Getwd()
 	os.Chdir(path)
 
@@ -125,13 +349,25 @@ func Autobuild(files []string, isgenerate bool) {
 		cmdName = "gopm"
 	}
 
-	var err error
+	// output keeps the errors of the build for the error page of the proxy
+	output := new(bytes.Buffer)
+	stderr := io.MultiWriter(os.Stderr, output)
+	err := runHooks(ctx, hookPreBuild, conf.Hooks.PreBuild, changed, stderr)
+	if err == nil && docsCache != nil {
+		generateDocs(ctx)
+	}
+	// the tests run alongside the build
+	var tests <-chan *testReport
+	if err == nil && testOn {
+		tests = startTests(changed)
+	}
 	// For applications use full import path like "github.com/.../.."
 	// are able to use "go install" to reduce build time.
-	if conf.GoInstall || conf.Gopm.Install {
-		icmd := exec.Command("go", "list", "./...")
+	if err == nil && (conf.GoInstall || conf.Gopm.Install) {
+		icmd := exec.CommandContext(ctx, "go", "list", "./...")
 		buf := bytes.NewBuffer([]byte(""))
 		icmd.Stdout = buf
+		icmd.Stderr = stderr
 		err = icmd.Run()
 		if err == nil {
 			list := strings.Split(buf.String(), "\n")[1:]
@@ -139,9 +375,9 @@ func Autobuild(files []string, isgenerate bool) {
 				if len(pkg) == 0 {
 					continue
 				}
-				icmd = exec.Command(cmdName, "install", pkg)
+				icmd = exec.CommandContext(ctx, cmdName, "install", pkg)
 				icmd.Stdout = os.Stdout
-				icmd.Stderr = os.Stderr
+				icmd.Stderr = stderr
 				err = icmd.Run()
 				if err != nil {
 					break
@@ -150,14 +386,6 @@ func Autobuild(files []string, isgenerate bool) {
 		}
 	}
 
-	if isgenerate {
-		icmd := exec.Command("fire", "generate", "docs")
-		icmd.Stdout = os.Stdout
-		icmd.Stderr = os.Stderr
-		icmd.Run()
-		helper.ColorLog("============== generate docs ===================\n")
-	}
-
 	if err == nil {
 		appName := appname
 		if runtime.GOOS == "windows" {
@@ -165,41 +393,179 @@ func Autobuild(files []string, isgenerate bool) {
 		}
 
 		args := []string{"build"}
+		if debugOn {
+			args = append(args, "-gcflags", debugGcflags)
+		}
 		args = append(args, "-o", appName)
 		args = append(args, files...)
 
-		bcmd := exec.Command(cmdName, args...)
+		bcmd := exec.CommandContext(ctx, cmdName, args...)
 		bcmd.Stdout = os.Stdout
-		bcmd.Stderr = os.Stderr
+		bcmd.Stderr = stderr
 		err = bcmd.Run()
 	}
+	if err == nil {
+		err = runHooks(ctx, hookPostBuild, conf.Hooks.PostBuild, changed, stderr)
+	}
+	if err == nil && tests != nil && conf.Test.Block {
+		select {
+		case report := <-tests:
+			if report != nil && !report.ok() {
+				err = errTestsFailed
+				output.WriteString(report.String())
+			}
+		case <-ctx.Done():
+		}
+	}
 
+	buildMu.Lock()
+	if ctx.Err() != nil {
+		buildMu.Unlock()
+		helper.ColorLog("[INFO] Build canceled, newer changes arrived\n")
+		return
+	}
+	// no newer build added changes, it would have canceled this one
+	buildChanged.reset()
+	buildMu.Unlock()
+	if err == errTestsFailed {
+		helper.ColorLog("[ERRO] Tests failed, %s is not restarted\n", appname)
+		serveFailure(output.String(), err)
+		return
+	}
 	if err != nil {
 		helper.ColorLog("[ERRO] ============== Build failed ===================\n")
+		serveFailure(output.String(), err)
 		return
 	}
 	helper.ColorLog("[SUCC] Build was successful\n")
-	Restart(appname)
+	devProxy.fail(nil)
+	// a newer change cancels the restart as well, the build it requested
+	// waits for the state lock and restarts the app with these changes too
+	if !Restart(ctx, appname, changed) {
+		buildMu.Lock()
+		buildChanged.add(changed)
+		buildMu.Unlock()
+	}
 }
 
-func Kill() {
-	defer func() {
-		if e := recover(); e != nil {
-			fmt.Println("Kill.recover -> ", e)
+// changeSet accumulates changed files, relative to the app.
+type changeSet struct {
+	// all is set once all the files have to be considered changed.
+	all     bool
+	changed map[string]bool
+}
+
+// add adds the changed files, nil meaning all of them.
+func (s *changeSet) add(changed []string) {
+	if changed == nil {
+		s.all = true
+		return
+	}
+	if s.changed == nil {
+		s.changed = make(map[string]bool)
+	}
+	for _, name := range changed {
+		s.changed[name] = true
+	}
+}
+
+// files returns the sorted changed files, nil if all of them changed.
+func (s *changeSet) files() []string {
+	if s.all {
+		return nil
+	}
+	changed := []string{}
+	for name := range s.changed {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func (s *changeSet) reset() {
+	*s = changeSet{}
+}
+
+// docsCache keeps the sources parsed by generateDocs, nil without -gendoc.
+var docsCache *generator.DocsCache
+
+// generateDocs regenerates docs/docs.go in process, a failure only being
+// logged as the docs of the previous build still compile.
+func generateDocs(ctx context.Context) {
+	crupath, _ := os.Getwd()
+	res, err := generator.Docs(ctx, generator.DocsOptions{AppPath: crupath, Cache: docsCache})
+	if err == nil {
+		var written []*generator.File
+		written, err = res.Write(crupath, nil)
+		for _, f := range written {
+			helper.ColorLog("[INFO] %s => %s\n", f.Kind, filepath.Join(crupath, f.Path))
 		}
-	}()
-	if cmd != nil && cmd.Process != nil {
-		err := cmd.Process.Kill()
-		if err != nil {
-			fmt.Println("Kill -> ", err)
+	}
+	if err != nil && ctx.Err() == nil {
+		helper.ColorLog("[WARN] Fail to generate docs[ %s ]\n", err)
+	}
+}
+
+// serveFailure makes the proxy serve the errors in output, or err if the
+// output has none, and releases the held requests.
+func serveFailure(output string, err error) {
+	if devProxy != nil {
+		if strings.TrimSpace(output) == "" {
+			output = err.Error()
 		}
+		devProxy.fail(parseBuildErrors(output))
+		helper.ColorLog("[INFO] Serving the build errors on %s\n", proxyAddr)
+		liveReload.reload()
 	}
+	devProxy.release()
 }
 
-func Restart(appname string) {
+// Kill stops the running app, sending restart.signal first and killing it
+// if it is still running after restart.grace_period.
+func Kill() {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	expectExit(cmd)
+	if err := cmd.Process.Signal(shutdownSignal()); err != nil {
+		// only kill is supported on windows
+		cmd.Process.Kill()
+	}
+	grace := time.Duration(conf.Restart.GracePeriod) * time.Second
+	select {
+	case <-exited:
+	case <-time.After(grace):
+		helper.ColorLog("[WARN] %s did not stop within %s, killing it\n", appname, grace)
+		cmd.Process.Kill()
+		<-exited
+	}
+	cmd = nil
+}
+
+// Restart stops the app, runs the pre_start hooks and starts it again. It
+// returns false, leaving the app stopped, if ctx is canceled meanwhile.
+func Restart(ctx context.Context, appname string, changed []string) bool {
+	if ctx.Err() != nil {
+		helper.ColorLog("[INFO] Restart canceled, newer changes arrived\n")
+		return false
+	}
 	helper.Debugf("kill running process")
+	resetCrashes()
+	devProxy.hold()
 	Kill()
-	go Start(appname)
+	output := new(bytes.Buffer)
+	err := runHooks(ctx, hookPreStart, conf.Hooks.PreStart, changed, io.MultiWriter(os.Stderr, output))
+	if ctx.Err() != nil {
+		helper.ColorLog("[INFO] Restart canceled, newer changes arrived\n")
+		return false
+	}
+	if err != nil {
+		helper.ColorLog("[ERRO] %s\n", err)
+		serveFailure(output.String(), err)
+		return true
+	}
+	Start(appname)
+	return true
 }
 
 func Start(appname string) {
@@ -208,15 +574,131 @@ func Start(appname string) {
 		appname = "./" + appname
 	}
 
-	cmd = exec.Command(appname)
+	// stderr keeps the last output of the app for crash reports
+	stderr := newTailBuffer(4096)
+	if debugOn {
+		cmd = debugCommand(appname, conf.CmdArgs)
+	} else {
+		cmd = exec.Command(appname)
+		cmd.Args = append([]string{appname}, conf.CmdArgs...)
+	}
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Args = append([]string{appname}, conf.CmdArgs...)
-	cmd.Env = append(os.Environ(), conf.Envs...)
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	cmd.Env = append(os.Environ(), appEnv()...)
+	if devProxy != nil {
+		cmd.Env = append(cmd.Env, "API_PORT=" + devProxy.port)
+	}
+
+	if err := cmd.Start(); err != nil {
+		helper.ColorLog("[ERRO] Fail to start %s[ %s ]\n", appname, err)
+		cmd = nil
+		devProxy.release()
+		return
+	}
+	done := make(chan struct{})
+	exited = done
+	devProxy.clearCrash()
+	devProxy.setApp(done)
+	go func(c *exec.Cmd) {
+		err := c.Wait()
+		close(done)
+		appExited(c, err, stderr)
+	}(cmd)
+	go waitReady(appname, envValue(cmd.Env, "API_PORT"), done)
+}
+
+// waitReady logs once the app accepts connections on port, or right away
+// if no port is known, and lets the proxy forward requests again.
+func waitReady(appname, port string, done chan struct{}) {
+	if port == "" {
+		helper.ColorLog("[INFO] %s is running...\n", appname)
+		appReady(done)
+		liveReload.reload()
+		return
+	}
+	timeout := time.Duration(conf.Restart.ReadyTimeout) * time.Second
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-done:
+			helper.ColorLog("[ERRO] %s exited before accepting connections\n", appname)
+			return
+		default:
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), 200 * time.Millisecond)
+		if err == nil {
+			conn.Close()
+			helper.ColorLog("[INFO] %s is running on :%s\n", appname, port)
+			appReady(done)
+			liveReload.reload()
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	helper.ColorLog("[WARN] %s is not accepting connections on :%s after %s\n", appname, port, timeout)
+	appReady(done)
+}
+
+// shutdownSignal returns the signal of restart.signal, SIGTERM if unknown.
+func shutdownSignal() os.Signal {
+	switch strings.ToUpper(conf.Restart.Signal) {
+	case "SIGINT":
+		return os.Interrupt
+	case "SIGKILL":
+		return os.Kill
+	case "SIGHUP":
+		return syscall.SIGHUP
+	case "SIGQUIT":
+		return syscall.SIGQUIT
+	case "SIGTERM", "":
+	default:
+		helper.ColorLog("[WARN] Unknown restart signal %s, using SIGTERM\n", conf.Restart.Signal)
+	}
+	return syscall.SIGTERM
+}
+
+// envValue returns the value of key in the KEY=VALUE list env, the last one
+// winning like for exec.Cmd.
+func envValue(env []string, key string) (value string) {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key + "=") {
+			value = kv[len(key) + 1:]
+		}
+	}
+	return
+}
+
+// appEnv returns the variables of .env and, with -env, .env.<env> for the
+// app followed by conf.Envs. Variables already set in fire's own environment
+// are not overridden by the .env files.
+func appEnv() (env []string) {
+	files := []string{".env"}
+	if envName != "" {
+		files = append(files, ".env." + envName.String())
+	}
+	vars, err := helper.LoadEnvFiles(files...)
+	if err != nil {
+		helper.ColorLog("[WARN] Fail to load env file[ %s ]\n", err)
+	}
+	for _, kv := range vars {
+		if _, ok := os.LookupEnv(kv[:strings.Index(kv, "=")]); ok {
+			continue
+		}
+		env = append(env, kv)
+	}
+	if envName != "" {
+		env = append(env, "APP_ENV=" + envName.String())
+	}
+	return append(env, conf.Envs...)
+}
 
-	go cmd.Run()
-	helper.ColorLog("[INFO] %s is running...\n", appname)
-	started <- true
+// isWatchedFile returns true if changes of the file trigger builds.
+func isWatchedFile(name string) bool {
+	// Skip TMP files for Sublime Text.
+	if checkTMPFile(name) {
+		return false
+	}
+	return chekcIfWatchExt(name) && !isIgnored(name, false)
 }
 
 // checkTMPFile returns true if the event was for TMP files.
@@ -229,12 +711,19 @@ func checkTMPFile(name string) bool {
 
 var watchExts = []string{".go"}
 
-// chekcIfWatchExt returns true if the name HasSuffix <watch_ext>.
+// chekcIfWatchExt returns true if the name HasSuffix <watch_ext> or matches
+// watch.actions.
 func chekcIfWatchExt(name string) bool {
 	for _, s := range watchExts {
 		if strings.HasSuffix(name, s) {
 			return true
 		}
 	}
+	crupath, _ := os.Getwd()
+	if rel, err := filepath.Rel(crupath, name); err == nil {
+		if action, ok := findAction(rel); ok && action != actionNone {
+			return true
+		}
+	}
 	return false
 }